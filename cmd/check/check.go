@@ -11,7 +11,8 @@ import (
 )
 
 func main() {
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	redactor := resource.NewRedactor(os.Stderr)
+	logger := zerolog.New(redactor).With().Timestamp().Logger()
 	zerolog.TimeFieldFormat = ""
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
@@ -21,7 +22,7 @@ func main() {
 			Msg("error reading from stdin")
 	}
 
-	vault, err := resource.New("vault", request, logger)
+	vault, err := resource.New("vault", request, logger, resource.WithRedactor(redactor))
 	if err != nil {
 		logger.Fatal().Err(err).Msg("error creating resource client")
 	}
@@ -14,7 +14,8 @@ import (
 )
 
 func main() {
-	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	redactor := resource.NewRedactor(os.Stderr)
+	logger := zerolog.New(redactor).With().Timestamp().Logger()
 
 	zerolog.TimeFieldFormat = ""
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -31,26 +32,27 @@ func main() {
 		version = fmt.Sprintf("%d", rand.Intn(100))
 	}
 
-	response := models.Response{
-		Metadata: nil,
-		Version: models.Version{
-			Version: version,
-		},
-	}
-
 	// first argument on stdin is the working directory
-	vault, err := resource.New(os.Args[1], request, logger)
+	vault, err := resource.New(os.Args[1], request, logger, resource.WithRedactor(redactor))
 	if err != nil {
 		logger.Fatal().Err(err).
 			Msg("error creating resource client")
 	}
 
-	err = vault.In()
+	metadata, err := vault.In()
 	if err != nil {
 		logger.Fatal().Err(err).
 			Msg("error running file for write")
 	}
 
+	response := models.Response{
+		Metadata: metadata,
+		Version: models.Version{
+			Path:    request.Version.Path,
+			Version: version,
+		},
+	}
+
 	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
 		logger.Fatal().Err(err).
 			Msg("writing response")
@@ -1,9 +1,43 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource"
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
 )
 
 func main() {
-	fmt.Println("[]")
+	redactor := resource.NewRedactor(os.Stderr)
+	logger := zerolog.New(redactor).With().Timestamp().Logger()
+
+	zerolog.TimeFieldFormat = ""
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	var request models.Request
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		logger.Fatal().Err(err).
+			Msg("error reading from stdin")
+	}
+
+	// first argument on stdin is the sources directory
+	vault, err := resource.New(os.Args[1], request, logger, resource.WithRedactor(redactor))
+	if err != nil {
+		logger.Fatal().Err(err).
+			Msg("error creating resource client")
+	}
+
+	response, err := vault.Out()
+	if err != nil {
+		logger.Fatal().Err(err).
+			Msg("error running put")
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
+		logger.Fatal().Err(err).
+			Msg("writing response")
+	}
 }
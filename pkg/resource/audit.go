@@ -0,0 +1,144 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// the supported audit sinks
+const (
+	auditStderr = "stderr"
+	auditFile   = "file"
+	auditVault  = "vault"
+)
+
+// access - records a path accessed by the step for auditing
+func (r *Resource) access(p, version string) {
+	r.accessed = append(r.accessed, models.Version{
+		Path:    p,
+		Version: version,
+	})
+}
+
+// identity - looks up the display name and accessor of the token in use
+func (r Resource) identity() (string, string) {
+	s, err := r.logical.Read("auth/token/lookup-self")
+	if err != nil || s == nil || s.Data == nil {
+		r.logger.Debug().Err(err).Msg("could not look up token identity")
+		if len(r.config.Source.RoleName) > 0 {
+			return fmt.Sprintf("approle-%s", r.config.Source.RoleName), ""
+		}
+		return "unknown", ""
+	}
+
+	name, _ := s.Data["display_name"].(string)
+	accessor, _ := s.Data["accessor"].(string)
+
+	return name, accessor
+}
+
+// audit - sends a record of the paths accessed by the step to the configured
+// sink
+func (r Resource) audit(operation string) error {
+	if len(r.config.Source.Audit.Sink) <= 0 {
+		return nil
+	}
+
+	b := buildFromEnv()
+	identity, accessor := r.identity()
+
+	record := models.AuditRecord{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		Operation: operation,
+		Team:      b.Team,
+		Pipeline:  b.Pipeline,
+		Job:       b.Job,
+		BuildID:   b.ID,
+		BuildName: b.Name,
+		BuildURL:  b.URL,
+		Identity:  identity,
+		Accessor:  accessor,
+		VaultAddr: r.client.Address(),
+		Paths:     r.accessed,
+	}
+	if record.Paths == nil {
+		record.Paths = []models.Version{}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	switch r.config.Source.Audit.Sink {
+	case auditStderr:
+		_, err = fmt.Fprintf(r.redactor, "%s\n", line)
+		return err
+
+	case auditFile:
+		return r.auditToFile(line)
+
+	case auditVault:
+		return r.auditToVault(record)
+	}
+
+	return nil
+}
+
+// auditToFile - appends a record to the audit file
+func (r Resource) auditToFile(line []byte) error {
+	f, err := os.OpenFile(r.config.Source.Audit.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit file: %v", err)
+	}
+
+	return f.Sync()
+}
+
+// auditToVault - writes a record under the audit path in vault, one secret
+// per step
+func (r Resource) auditToVault(record models.AuditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	name := record.BuildID
+	if len(name) <= 0 {
+		name = "build"
+	}
+
+	p := fmt.Sprintf(
+		"%s/%s-%s-%d",
+		strings.TrimSuffix(r.config.Source.Audit.Path, "/"),
+		name,
+		record.Operation,
+		time.Now().UTC().UnixNano(),
+	)
+
+	if m, err := r.mountInfo(p); err == nil && m.KVVersion == 2 {
+		p = kv2Path(m, p, "data")
+		data = map[string]interface{}{"data": data}
+	}
+
+	if _, err := r.logical.Write(p, data); err != nil {
+		return fmt.Errorf("error writing audit record to vault: %v", err)
+	}
+
+	return nil
+}
@@ -1,8 +1,11 @@
 package resource
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/rs/zerolog"
 )
 
 // getRoleID - gets a role_id from a role_name
@@ -10,7 +13,7 @@ func (r *Resource) getRoleID() error {
 	if len(r.config.Source.RoleName) <= 0 {
 		return errors.New("no role_name provided")
 	}
-	resp, err := r.client.Logical().Read(
+	resp, err := r.logical.Read(
 		fmt.Sprintf(
 			"auth/approle/role/%s/role-id",
 			r.config.Source.RoleName,
@@ -34,12 +37,24 @@ func (r *Resource) getSecretID() error {
 	if len(r.roleID) <= 0 {
 		return errors.New("no role_id provided")
 	}
-	resp, err := r.client.Logical().Write(
+	// secret_id metadata is attached to tokens issued by logging in with it
+	var data map[string]interface{}
+	if meta := buildFromEnv().metadata(); len(meta) > 0 {
+		b, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		data = map[string]interface{}{
+			"metadata": string(b),
+		}
+	}
+
+	resp, err := r.logical.Write(
 		fmt.Sprintf(
 			"auth/approle/role/%s/secret-id",
 			r.config.Source.RoleName,
 		),
-		nil,
+		data,
 	)
 	if err != nil {
 		return err
@@ -47,6 +62,7 @@ func (r *Resource) getSecretID() error {
 
 	if secretID, ok := resp.Data["secret_id"]; ok {
 		r.secretID = secretID.(string)
+		r.redactor.Add(r.secretID)
 		r.logger.Debug().Msg("secret_id success")
 		return nil
 	}
@@ -60,7 +76,7 @@ func (r *Resource) loginWithAppRole() error {
 		return errors.New("role_id or secret_id not provided when authenticating")
 	}
 
-	resp, err := r.client.Logical().Write(
+	resp, err := r.logical.Write(
 		"auth/approle/login",
 		map[string]interface{}{
 			"role_id":   r.roleID,
@@ -75,23 +91,30 @@ func (r *Resource) loginWithAppRole() error {
 		return errors.New("no authentication returned")
 	}
 
+	r.redactor.Add(resp.Auth.ClientToken)
 	r.client.SetToken(resp.Auth.ClientToken)
 	return nil
 }
 
 // renewToken - renews a token
 func (r *Resource) renewToken() error {
+	// the agent renews its own auto-auth token
+	if r.config.Source.Agent && len(r.config.Source.VaultToken) <= 0 {
+		return nil
+	}
+
 	if len(r.config.Source.VaultToken) <= 0 {
 		return errors.New("error renewing vault client token, no vault_token provided")
 	}
 
 	r.logger.Debug().Msg("attempting renewal of token")
 
-	resp, err := r.client.Logical().Write("auth/token/renew-self", nil)
+	resp, err := r.logical.Write("auth/token/renew-self", nil)
 	if err != nil {
 		return err
 	}
 	if resp.Auth != nil {
+		r.redactor.Add(resp.Auth.ClientToken)
 		r.client.SetToken(resp.Auth.ClientToken)
 		r.logger.Debug().Msg("succesfully renewed token")
 		return nil
@@ -113,22 +136,98 @@ func (r *Resource) setToken() error {
 			return err
 		}
 
-		err = r.loginWithAppRole()
-		if err != nil {
-			return err
-		}
-		return nil
+		return r.loginWithAppRole()
 	}
 
 	if len(r.config.Source.RoleID) > 0 && len(r.config.Source.SecretID) > 0 {
 		r.roleID = r.config.Source.RoleID
 		r.secretID = r.config.Source.SecretID
-		err := r.loginWithAppRole()
+		return r.loginWithAppRole()
+	}
+
+	return nil
+}
+
+// readsLeases - whether a get may be issued leased secrets. leases are
+// revoked along with the token that created them, so they must not be read
+// with a child token which is revoked when the step is done
+func (r Resource) readsLeases() bool {
+	switch r.config.Source.Mode {
+	case modePKI:
+		// certificates are leased when the role sets generate_lease
+		return true
+	case modeSSH:
+		return false
+	}
+
+	// patterns only match kv mounts, which never lease
+	for p := range r.config.Source.VaultPaths {
+		if isGlob(p) {
+			continue
+		}
+
+		m, err := r.mountInfo(p)
 		if err != nil {
-			return err
+			r.logger.Debug().Err(err).Str("path", p).
+				Msg("could not determine mount, assuming dynamic")
+			return true
 		}
+		if m.dynamic() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createChildToken - replaces the client token with a child token carrying
+// the build metadata, so requests can be traced back to the build. the child
+// token is revoked when the step is done, including when it fails
+func (r *Resource) createChildToken() error {
+	if !r.config.Source.ChildToken {
 		return nil
 	}
 
+	resp, err := r.logical.Write("auth/token/create", map[string]interface{}{
+		"meta":         buildFromEnv().metadata(),
+		"ttl":          r.config.Source.ChildTokenTTL,
+		"display_name": "concourse",
+	})
+	if err != nil {
+		return fmt.Errorf("error creating child token: %v", err)
+	}
+
+	if resp == nil || resp.Auth == nil {
+		return errors.New("no child token returned")
+	}
+
+	r.redactor.Add(resp.Auth.ClientToken)
+	r.client.SetToken(resp.Auth.ClientToken)
+	r.childToken = true
+	r.logger.Debug().Msg("created child token")
+
+	// fatal errors exit without running deferred calls
+	r.logger = r.logger.Hook(zerolog.HookFunc(
+		func(e *zerolog.Event, level zerolog.Level, msg string) {
+			if level == zerolog.FatalLevel {
+				r.revokeChildToken()
+			}
+		},
+	))
+
 	return nil
 }
+
+// revokeChildToken - revokes the child token once the step is done with it
+func (r *Resource) revokeChildToken() {
+	if !r.childToken {
+		return
+	}
+	r.childToken = false
+
+	if _, err := r.logical.Write("auth/token/revoke-self", nil); err != nil {
+		r.logger.Warn().Err(err).Msg("error revoking child token")
+		return
+	}
+	r.logger.Debug().Msg("revoked child token")
+}
@@ -0,0 +1,78 @@
+package resource
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// build - metadata of the concourse build running the step, as exposed to
+// get and put steps through the environment. check steps have none
+type build struct {
+	ID       string
+	Name     string
+	Job      string
+	Pipeline string
+	Team     string
+	URL      string
+}
+
+// buildFromEnv - reads the build metadata from the environment
+func buildFromEnv() build {
+	b := build{
+		ID:       os.Getenv("BUILD_ID"),
+		Name:     os.Getenv("BUILD_NAME"),
+		Job:      os.Getenv("BUILD_JOB_NAME"),
+		Pipeline: os.Getenv("BUILD_PIPELINE_NAME"),
+		Team:     os.Getenv("BUILD_TEAM_NAME"),
+	}
+
+	if atc := os.Getenv("ATC_EXTERNAL_URL"); len(atc) > 0 && len(b.Pipeline) > 0 && len(b.Job) > 0 {
+		b.URL = fmt.Sprintf(
+			"%s/teams/%s/pipelines/%s/jobs/%s/builds/%s",
+			atc,
+			url.PathEscape(b.Team),
+			url.PathEscape(b.Pipeline),
+			url.PathEscape(b.Job),
+			url.PathEscape(b.Name),
+		)
+	}
+
+	return b
+}
+
+// metadata - the build metadata as vault token metadata
+func (b build) metadata() map[string]string {
+	m := make(map[string]string, 0)
+	for k, v := range map[string]string{
+		"concourse_team":       b.Team,
+		"concourse_pipeline":   b.Pipeline,
+		"concourse_job":        b.Job,
+		"concourse_build_id":   b.ID,
+		"concourse_build_name": b.Name,
+	} {
+		if len(v) > 0 {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// headers - the build metadata as request headers, which vault audit devices
+// record once they are enabled with sys/config/auditing/request-headers
+func (b build) headers() http.Header {
+	h := make(http.Header, 0)
+	for k, v := range map[string]string{
+		"X-Concourse-Team":       b.Team,
+		"X-Concourse-Pipeline":   b.Pipeline,
+		"X-Concourse-Job":        b.Job,
+		"X-Concourse-Build-Id":   b.ID,
+		"X-Concourse-Build-Name": b.Name,
+	} {
+		if len(v) > 0 {
+			h.Set(k, v)
+		}
+	}
+	return h
+}
@@ -0,0 +1,82 @@
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileMode - returns the configured file mode for written files
+func (r Resource) fileMode() os.FileMode {
+	m, err := strconv.ParseUint(r.config.Source.FileMode, 8, 32)
+	if err != nil {
+		return 0600
+	}
+	return os.FileMode(m)
+}
+
+// workPath - the path of name relative to the working directory. absolute
+// paths and paths which leave the working directory are rejected, so params
+// can never read or write files outside the build
+func (r Resource) workPath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("%s must be relative to the build directory", name)
+	}
+
+	p := filepath.Join(r.workDir, name)
+	rel, err := filepath.Rel(r.workDir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the build directory", name)
+	}
+
+	return p, nil
+}
+
+// writeFile - atomically writes b to name relative to the working directory.
+// the data is written to a temporary file in the same directory, synced and
+// then renamed into place so readers never observe a partial or stale file
+func (r Resource) writeFile(name string, b []byte, mode os.FileMode) error {
+	dest, err := r.workPath(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(
+		filepath.Dir(dest),
+		fmt.Sprintf(".%s.tmp", filepath.Base(dest)),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %s: %v", name, err)
+	}
+
+	// cleanup is a no-op once the file has been renamed into place
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return fmt.Errorf("error setting permissions on %s: %v", name, err)
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing %s: %v", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %v", name, err)
+	}
+
+	if err := os.Rename(f.Name(), dest); err != nil {
+		return fmt.Errorf("error moving %s into place: %v", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// the character classes of generated values
+const (
+	lowercase = "abcdefghijklmnopqrstuvwxyz"
+	uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits    = "0123456789"
+	symbols   = "!@#$%^&*-_=+"
+)
+
+// charClass - a class of characters and the minimum a value must contain
+type charClass struct {
+	name  string
+	chars string
+	min   int
+}
+
+// classes - the character classes of a generator, limited to the characters
+// of its charset
+func classes(g models.Generate) []charClass {
+	in := func(class string) string {
+		var b strings.Builder
+		for _, c := range class {
+			if strings.ContainsRune(g.Charset, c) {
+				b.WriteRune(c)
+			}
+		}
+		return b.String()
+	}
+
+	var other strings.Builder
+	for _, c := range g.Charset {
+		if !strings.ContainsRune(lowercase+uppercase+digits, c) {
+			other.WriteRune(c)
+		}
+	}
+
+	return []charClass{
+		{"min_lowercase", in(lowercase), g.MinLowercase},
+		{"min_uppercase", in(uppercase), g.MinUppercase},
+		{"min_digits", in(digits), g.MinDigits},
+		{"min_symbols", other.String(), g.MinSymbols},
+	}
+}
+
+// randomIndex - a uniformly random index below n
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// generateValue - generates a random value of length characters from the
+// charset, containing at least the minimum of each character class
+func generateValue(g models.Generate) (string, error) {
+	value := make([]rune, 0, g.Length)
+	for _, c := range classes(g) {
+		chars := []rune(c.chars)
+		for i := 0; i < c.min; i++ {
+			n, err := randomIndex(len(chars))
+			if err != nil {
+				return "", err
+			}
+			value = append(value, chars[n])
+		}
+	}
+
+	charset := []rune(g.Charset)
+	for len(value) < g.Length {
+		n, err := randomIndex(len(charset))
+		if err != nil {
+			return "", err
+		}
+		value = append(value, charset[n])
+	}
+
+	// the characters required by each class are spread through the value
+	for i := len(value) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		value[i], value[j] = value[j], value[i]
+	}
+
+	return string(value), nil
+}
+
+// generate - generates a value with the configured password policy, or with
+// the resource's own generator. the value is redacted before it is returned
+func (r Resource) generate() (string, error) {
+	g := r.config.Params.Generate
+
+	if len(g.Policy) <= 0 {
+		value, err := generateValue(g)
+		if err != nil {
+			return "", fmt.Errorf("error generating value: %v", err)
+		}
+		r.redactor.Add(value)
+		return value, nil
+	}
+
+	s, err := r.logical.Read(fmt.Sprintf("sys/policies/password/%s/generate", g.Policy))
+	if err != nil {
+		return "", fmt.Errorf("error generating value with password policy %s: %v", g.Policy, err)
+	}
+
+	if s == nil || s.Data == nil {
+		return "", fmt.Errorf("password policy %s returned no value", g.Policy)
+	}
+
+	value, ok := s.Data["password"].(string)
+	if !ok || len(value) <= 0 {
+		return "", fmt.Errorf("password policy %s returned no value", g.Policy)
+	}
+	r.redactor.Add(value)
+
+	return value, nil
+}
@@ -0,0 +1,203 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// isGlob - whether a vault path is a glob pattern
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// expandPaths - expands the glob patterns in vault_paths into the paths they
+// match. patterns are matched against secret names segment by segment, where
+// * matches within a segment and ** matches any number of segments. paths are
+// returned with the version of the pattern that matched them, along with the
+// matches of each pattern
+func (r Resource) expandPaths() (map[string]int, map[string][]string, error) {
+	var (
+		paths    = make(map[string]int, 0)
+		patterns = make(map[string][]string, 0)
+		total    int
+	)
+
+	for p, ver := range r.config.Source.VaultPaths {
+		if !isGlob(p) {
+			paths[p] = ver
+			continue
+		}
+
+		matches, err := r.glob(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error expanding %s: %v", p, err)
+		}
+
+		total += len(matches)
+		if total > r.config.Source.MaxPaths {
+			return nil, nil, fmt.Errorf(
+				"vault_paths patterns matched more than max_paths (%d) paths",
+				r.config.Source.MaxPaths,
+			)
+		}
+
+		if len(matches) <= 0 {
+			r.logger.Warn().Str("pattern", p).Msg("pattern matched no paths")
+		}
+
+		for _, m := range matches {
+			paths[m] = ver
+		}
+		patterns[p] = matches
+	}
+
+	return paths, patterns, nil
+}
+
+// glob - lists the secrets matching a pattern
+func (r Resource) glob(pattern string) ([]string, error) {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+
+	var base []string
+	for _, s := range segments {
+		if isGlob(s) {
+			break
+		}
+		base = append(base, s)
+	}
+
+	if len(base) <= 0 {
+		return nil, errors.New("patterns must begin with a mount path")
+	}
+
+	m, err := r.mountInfo(strings.Join(base, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if m.KVVersion <= 0 {
+		return nil, fmt.Errorf("patterns are only supported on kv mounts, not %s", m.Type)
+	}
+
+	// names are matched relative to the mount, without the kv2 data prefix
+	mountPath := strings.Trim(m.Path, "/")
+	name := strings.Trim(strings.TrimPrefix(strings.Join(segments, "/"), mountPath), "/")
+	if m.KVVersion == 2 {
+		name = kv2Name(m, pattern)
+	}
+	nameSegments := strings.Split(name, "/")
+
+	var prefix []string
+	for _, s := range nameSegments {
+		if isGlob(s) {
+			break
+		}
+		prefix = append(prefix, s)
+	}
+
+	// without ** there is no need to list deeper than the pattern
+	depth := len(nameSegments) - len(prefix)
+	if strings.Contains(name, "**") {
+		depth = -1
+	}
+
+	listPath, readPath := mountPath, mountPath
+	if m.KVVersion == 2 {
+		listPath = fmt.Sprintf("%s/metadata", mountPath)
+		readPath = fmt.Sprintf("%s/data", mountPath)
+	}
+
+	names, err := r.list(listPath, strings.Join(prefix, "/"), depth)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, n := range names {
+		if matchSegments(nameSegments, strings.Split(n, "/")) {
+			matches = append(matches, fmt.Sprintf("%s/%s", readPath, n))
+		}
+	}
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+// list - recursively lists the secret names under dir, descending at most
+// depth folders. a negative depth is unlimited
+func (r Resource) list(mountPath, dir string, depth int) ([]string, error) {
+	p := strings.Trim(fmt.Sprintf("%s/%s", mountPath, dir), "/")
+
+	s, err := r.logical.List(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil || s.Data == nil {
+		return nil, nil
+	}
+
+	keys, _ := s.Data["keys"].([]interface{})
+
+	var names []string
+	for _, k := range keys {
+		key := strings.Trim(fmt.Sprintf("%s/%v", dir, k), "/")
+
+		if !strings.HasSuffix(fmt.Sprintf("%v", k), "/") {
+			names = append(names, key)
+			continue
+		}
+
+		if depth == 1 {
+			continue
+		}
+
+		n, err := r.list(mountPath, key, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, n...)
+	}
+
+	return names, nil
+}
+
+// matchSegments - matches a name against a pattern segment by segment
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) <= 0 {
+			return false
+		}
+
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) <= 0
+}
+
+// matchesVersion - a version identifying the set of paths a pattern matched
+func matchesVersion(matches []string) string {
+	h := sha256.New()
+	for _, m := range matches {
+		fmt.Fprintln(h, m)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:12]
+}
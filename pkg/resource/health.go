@@ -0,0 +1,107 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// the ranks of nodes able to serve requests, best first. performance standbys
+// serve reads locally while standbys forward every request to the active node
+const (
+	rankActive = iota
+	rankPerformanceStandby
+	rankStandby
+)
+
+// healthRank - ranks a node by its health, returning false if it cannot serve
+// requests at all
+func healthRank(h *api.HealthResponse) (int, string, bool) {
+	switch {
+	case !h.Initialized:
+		return 0, "uninitialized", false
+	case h.Sealed:
+		return 0, "sealed", false
+	case strings.Contains(h.ReplicationDRMode, "secondary"):
+		return 0, "dr secondary", false
+	case h.PerformanceStandby:
+		return rankPerformanceStandby, "performance standby", true
+	case h.Standby:
+		return rankStandby, "standby", true
+	default:
+		return rankActive, "active", true
+	}
+}
+
+// probeAddrs - probes the health of every configured address through l,
+// returning the addresses able to serve requests ordered by health and then
+// configuration
+func (r Resource) probeAddrs(l *logical) ([]string, error) {
+	type candidate struct {
+		addr string
+		rank int
+	}
+
+	var candidates []candidate
+	for _, addr := range r.config.Source.VaultAddrs {
+		h, err := l.health(addr)
+		if err != nil {
+			r.logger.Warn().Err(err).Str("vault_addr", addr).
+				Msg("skipping unreachable vault address")
+			continue
+		}
+
+		rank, state, ok := healthRank(h)
+		r.logger.Debug().Str("vault_addr", addr).Str("state", state).
+			Msg("probed vault address")
+		if !ok {
+			r.logger.Warn().Str("vault_addr", addr).Str("state", state).
+				Msg("skipping vault address which cannot serve requests")
+			continue
+		}
+
+		candidates = append(candidates, candidate{addr, rank})
+	}
+
+	if len(candidates) <= 0 {
+		return nil, errors.New("no healthy vault address found in vault_addrs")
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	addrs := make([]string, len(candidates))
+	for i, c := range candidates {
+		addrs[i] = c.addr
+	}
+
+	return addrs, nil
+}
+
+// selectAddr - points the client at the healthiest of vault_addrs, keeping
+// the rest for failover by l
+func (r *Resource) selectAddr(l *logical) error {
+	if len(r.config.Source.VaultAddrs) <= 0 {
+		l.addrs = []string{r.client.Address()}
+		return nil
+	}
+
+	addrs, err := r.probeAddrs(l)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.SetAddress(addrs[0]); err != nil {
+		return fmt.Errorf("error setting vault address: %v", err)
+	}
+	l.addrs = addrs
+
+	r.logger.Debug().Str("vault_addr", addrs[0]).Strs("failover", addrs[1:]).
+		Msg("selected vault address")
+
+	return nil
+}
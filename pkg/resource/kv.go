@@ -0,0 +1,391 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// casFromInput - the cas which uses the version read by a get step
+const casFromInput = "from_input"
+
+// casMismatch - the error vault returns when a cas does not match
+const casMismatch = "check-and-set parameter did not match"
+
+// the methods of writing a kv secret
+const (
+	methodWrite = "write"
+	methodPatch = "patch"
+)
+
+// hasStatus - whether an error returned by vault carries one of the status
+// codes
+func hasStatus(err error, codes ...int) bool {
+	for _, code := range codes {
+		if strings.Contains(err.Error(), fmt.Sprintf("Code: %d.", code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergePatch - applies a JSON merge patch to a map, returning a new map.
+// nested maps are merged and keys set to null are removed
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(target)+len(patch))
+	for k, v := range target {
+		merged[k] = v
+	}
+
+	for k, v := range patch {
+		switch t := v.(type) {
+		case nil:
+			delete(merged, k)
+		case map[string]interface{}:
+			m, _ := merged[k].(map[string]interface{})
+			merged[k] = mergePatch(m, t)
+		default:
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// changedKeys - the top level keys set and removed between two versions of
+// a secret
+func changedKeys(before, after map[string]interface{}) ([]string, []string) {
+	var changed, removed []string
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return changed, removed
+}
+
+// writeData - the data to write, from data or data_file, with the generated
+// value when one is configured
+func (r Resource) writeData() (map[string]interface{}, error) {
+	data, err := r.readData()
+	if err != nil {
+		return nil, err
+	}
+
+	key := r.config.Params.Generate.Key
+	if len(key) <= 0 {
+		return data, nil
+	}
+
+	if _, ok := data[key]; ok {
+		return nil, fmt.Errorf("generate.key %s is also set in data_file", key)
+	}
+
+	value, err := r.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		generated[k] = v
+	}
+	generated[key] = value
+
+	return generated, nil
+}
+
+// readData - the data given by data or data_file
+func (r Resource) readData() (map[string]interface{}, error) {
+	if len(r.config.Params.DataFile) <= 0 {
+		return r.config.Params.Data, nil
+	}
+
+	p, err := r.workPath(r.config.Params.DataFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data_file: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading data_file: %v", err)
+	}
+
+	data := make(map[string]interface{}, 0)
+	if err := json.Unmarshal(b, &data); err == nil {
+		return data, nil
+	}
+
+	var y map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &y); err != nil {
+		return nil, fmt.Errorf("error parsing data_file as JSON or YAML: %v", err)
+	}
+
+	data, ok := stringKeys(y).(map[string]interface{})
+	if !ok {
+		return nil, errors.New("data_file must contain a map")
+	}
+
+	return data, nil
+}
+
+// stringKeys - converts the maps yaml decodes into maps with string keys
+func stringKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[fmt.Sprintf("%v", k)] = stringKeys(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range t {
+			t[i] = stringKeys(v)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// readVersions - reads the versions file written by a get step from dir
+func (r Resource) readVersions(dir string) (map[string]int, error) {
+	p, err := r.workPath(filepath.Join(dir, versionsFile))
+	if err != nil {
+		return nil, fmt.Errorf("invalid versions_from: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf(
+			"no versions file in %s, set write_versions on the get step", dir,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading versions from %s: %v", dir, err)
+	}
+
+	versions := make(map[string]int, 0)
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return nil, fmt.Errorf("error parsing versions from %s: %v", dir, err)
+	}
+
+	return versions, nil
+}
+
+// casVersion - the check-and-set version of a write to the kv2 data path p,
+// returning false if the write is not checked
+func (r Resource) casVersion(m *mount, p string) (int, bool, error) {
+	cas := string(r.config.Params.CAS)
+	if len(cas) <= 0 {
+		return 0, false, nil
+	}
+
+	if cas != casFromInput {
+		n, err := strconv.Atoi(cas)
+		return n, true, err
+	}
+
+	versions, err := r.readVersions(r.config.Params.VersionsFrom)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for read, v := range versions {
+		if kv2Path(m, read, "data") == p {
+			return v, true, nil
+		}
+	}
+
+	return 0, false, fmt.Errorf(
+		"no version of %s was read by the get step in %s",
+		p, r.config.Params.VersionsFrom,
+	)
+}
+
+// casConflict - the error for a write whose cas did not match the current
+// version of the secret
+func (r Resource) casConflict(m *mount, p string, cas int) error {
+	current := "unknown"
+	if s, err := r.logical.Read(kv2Path(m, p, "metadata")); err == nil {
+		current = "0"
+		if s != nil && s.Data != nil {
+			current = fmt.Sprintf("%v", s.Data["current_version"])
+		}
+	}
+
+	return fmt.Errorf(
+		"check-and-set conflict writing %s: expected version %d but the current version is %s",
+		p, cas, current,
+	)
+}
+
+// writeSecret - writes data to the kv secret at path, checking the version of
+// kv2 secrets against cas
+func (r *Resource) writeSecret() (models.Version, models.Metadata, error) {
+	p := r.config.Params.Path
+	version := models.Version{Path: p}
+
+	data, err := r.writeData()
+	if err != nil {
+		return version, nil, err
+	}
+	r.redactor.AddValue(data)
+
+	m, err := r.mountInfo(p)
+	if err != nil {
+		return version, nil, fmt.Errorf("error looking up the mount of %s: %v", p, err)
+	}
+
+	if m.KVVersion != 2 {
+		if r.config.Params.Method == methodPatch {
+			return version, nil, fmt.Errorf("method patch is only supported on kv2 mounts, %s is not one", p)
+		}
+
+		if len(r.config.Params.CAS) > 0 {
+			return version, nil, fmt.Errorf("cas is only supported on kv2 mounts, %s is not one", p)
+		}
+
+		if _, err := r.logical.Write(p, data); err != nil {
+			return version, nil, fmt.Errorf("error writing %s: %v", p, err)
+		}
+
+		r.access(p, "")
+		version.Version = fmt.Sprintf("%d", time.Now().UTC().Unix())
+		return version, r.generatedMetadata(models.Metadata{{Key: "path", Value: p}}), nil
+	}
+
+	p = kv2Path(m, p, "data")
+	version.Path = p
+
+	body := map[string]interface{}{"data": data}
+	cas, checked, err := r.casVersion(m, p)
+	if err != nil {
+		return version, nil, err
+	}
+	if checked {
+		body["options"] = map[string]interface{}{"cas": cas}
+	}
+
+	var (
+		before map[string]interface{}
+		s      *api.Secret
+	)
+	if r.config.Params.Method == methodPatch {
+		before, s, err = r.patchSecret(p, data, cas, checked)
+	} else {
+		s, err = r.logical.Write(p, body)
+	}
+	if err != nil {
+		if checked && strings.Contains(err.Error(), casMismatch) {
+			return version, nil, r.casConflict(m, p, cas)
+		}
+		return version, nil, fmt.Errorf("error writing %s: %v", p, err)
+	}
+
+	if s == nil || s.Data == nil {
+		return version, nil, fmt.Errorf("no version returned writing %s", p)
+	}
+
+	version.Version = fmt.Sprintf("%v", s.Data["version"])
+	r.access(p, version.Version)
+	r.logger.Info().Str("path", p).Str("version", version.Version).
+		Msg("wrote secret")
+
+	metadata := models.Metadata{
+		{Key: "path", Value: p},
+		{Key: "version", Value: version.Version},
+	}
+
+	if r.config.Params.Method == methodPatch {
+		changed, removed := changedKeys(before, mergePatch(before, data))
+		metadata = append(metadata,
+			models.MetadataKvP{Key: "changed", Value: strings.Join(changed, ",")},
+			models.MetadataKvP{Key: "removed", Value: strings.Join(removed, ",")},
+		)
+	}
+
+	return version, r.generatedMetadata(metadata), nil
+}
+
+// generatedMetadata - adds the key of a generated value, never the value, to
+// the metadata of a write
+func (r Resource) generatedMetadata(metadata models.Metadata) models.Metadata {
+	if key := r.config.Params.Generate.Key; len(key) > 0 {
+		return append(metadata, models.MetadataKvP{Key: "generated", Value: key})
+	}
+	return metadata
+}
+
+// patchSecret - merges data into the kv2 secret at the data path p, returning
+// the data it held before. vaults which cannot patch, either because they
+// predate the patch endpoint or because the token lacks the patch
+// capability, are patched by writing the merged data with a cas of the
+// version read, so a concurrent write is not lost
+func (r *Resource) patchSecret(
+	p string,
+	data map[string]interface{},
+	cas int,
+	checked bool,
+) (map[string]interface{}, *api.Secret, error) {
+	current, err := r.logical.Read(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if current == nil || current.Data == nil {
+		return nil, nil, fmt.Errorf("%s does not exist, only existing secrets can be patched", p)
+	}
+
+	before, _ := current.Data["data"].(map[string]interface{})
+	r.redactor.AddValue(before)
+
+	body := map[string]interface{}{"data": data}
+	if checked {
+		body["options"] = map[string]interface{}{"cas": cas}
+	}
+
+	s, err := r.logical.Patch(p, body)
+	if err == nil || !hasStatus(err, 403, 405) {
+		return before, s, err
+	}
+
+	r.logger.Debug().Err(err).Str("path", p).
+		Msg("could not patch, writing the merged secret instead")
+
+	if !checked {
+		meta, _ := current.Data["metadata"].(map[string]interface{})
+		cas = versionFromMetadata(meta).Version
+	}
+
+	s, err = r.logical.Write(p, map[string]interface{}{
+		"data":    mergePatch(before, data),
+		"options": map[string]interface{}{"cas": cas},
+	})
+	if err != nil && !checked && strings.Contains(err.Error(), casMismatch) {
+		return before, nil, fmt.Errorf("%s changed while it was being patched: %v", p, err)
+	}
+
+	return before, s, err
+}
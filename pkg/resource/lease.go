@@ -0,0 +1,127 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// readLeases - reads the leases file written by a get step from dir
+func (r Resource) readLeases(dir string) ([]models.Lease, error) {
+	p, err := r.workPath(filepath.Join(dir, leasesFile))
+	if err != nil {
+		return nil, fmt.Errorf("invalid lease manifest directory: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lease manifest from %s: %v", dir, err)
+	}
+
+	var leases []models.Lease
+	if err := json.Unmarshal(b, &leases); err != nil {
+		return nil, fmt.Errorf("error parsing lease manifest from %s: %v", dir, err)
+	}
+
+	return leases, nil
+}
+
+// renewLeases - renews every renewable lease in the leases file in dir
+func (r *Resource) renewLeases(dir string) (models.Metadata, error) {
+	leases, err := r.readLeases(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		metadata models.Metadata
+		failed   int
+	)
+	for _, l := range leases {
+		if !l.Renewable {
+			metadata = append(metadata, models.MetadataKvP{
+				Key:   l.LeaseID,
+				Value: "not renewable",
+			})
+			continue
+		}
+
+		s, err := r.logical.Write("sys/leases/renew", map[string]interface{}{
+			"lease_id":  l.LeaseID,
+			"increment": r.config.Params.Increment,
+		})
+		if err != nil {
+			failed++
+			r.logger.Error().Err(err).Str("lease_id", l.LeaseID).
+				Msg("error renewing lease")
+			metadata = append(metadata, models.MetadataKvP{
+				Key:   l.LeaseID,
+				Value: "renewal failed",
+			})
+			continue
+		}
+
+		r.access("sys/leases/renew", l.LeaseID)
+
+		ttl := 0
+		if s != nil {
+			ttl = s.LeaseDuration
+		}
+		r.logger.Info().Str("lease_id", l.LeaseID).Int("ttl", ttl).
+			Msg("renewed lease")
+		metadata = append(metadata, models.MetadataKvP{
+			Key:   l.LeaseID,
+			Value: fmt.Sprintf("renewed ttl=%ds", ttl),
+		})
+	}
+
+	if failed > 0 {
+		return metadata, fmt.Errorf("%d of %d lease(s) could not be renewed", failed, len(leases))
+	}
+
+	return metadata, nil
+}
+
+// revokeLeases - revokes every lease in the leases file in dir
+func (r *Resource) revokeLeases(dir string) (models.Metadata, error) {
+	leases, err := r.readLeases(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		metadata models.Metadata
+		failed   int
+	)
+	for _, l := range leases {
+		_, err := r.logical.Write("sys/leases/revoke", map[string]interface{}{
+			"lease_id": l.LeaseID,
+		})
+		if err != nil {
+			failed++
+			r.logger.Error().Err(err).Str("lease_id", l.LeaseID).
+				Msg("error revoking lease")
+			metadata = append(metadata, models.MetadataKvP{
+				Key:   l.LeaseID,
+				Value: "revocation failed",
+			})
+			continue
+		}
+
+		r.access("sys/leases/revoke", l.LeaseID)
+		r.logger.Info().Str("lease_id", l.LeaseID).Msg("revoked lease")
+		metadata = append(metadata, models.MetadataKvP{
+			Key:   l.LeaseID,
+			Value: "revoked",
+		})
+	}
+
+	if failed > 0 {
+		return metadata, fmt.Errorf("%d of %d lease(s) could not be revoked", failed, len(leases))
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,301 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/rs/zerolog"
+)
+
+//go:generate counterfeiter -o ../../test/fakes/fake_logical.go . Logical
+
+// Logical - the logical requests the resource makes to vault
+type Logical interface {
+	Read(p string) (*api.Secret, error)
+	ReadWithData(p string, data map[string][]string) (*api.Secret, error)
+	List(p string) (*api.Secret, error)
+	Write(p string, data map[string]interface{}) (*api.Secret, error)
+	Patch(p string, data map[string]interface{}) (*api.Secret, error)
+	Delete(p string) (*api.Secret, error)
+}
+
+// logical - makes logical requests to vault. every request is bound to the
+// deadline of the step, times out on its own, is retried with backoff on
+// connection errors and retryable status codes and fails over across addrs
+type logical struct {
+	mu             sync.Mutex
+	addrs          []string
+	client         *api.Client
+	ctx            context.Context
+	logger         zerolog.Logger
+	retries        int
+	requestTimeout time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	retryable      map[int]bool
+}
+
+// Read - reads a path
+func (l *logical) Read(p string) (*api.Secret, error) {
+	return l.ReadWithData(p, nil)
+}
+
+// ReadWithData - reads a path with query parameters
+func (l *logical) ReadWithData(p string, data map[string][]string) (*api.Secret, error) {
+	return l.request("GET", p, data, nil)
+}
+
+// List - lists a path
+func (l *logical) List(p string) (*api.Secret, error) {
+	return l.request("LIST", p, nil, nil)
+}
+
+// Write - writes data to a path
+func (l *logical) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	return l.request("PUT", p, nil, data)
+}
+
+// Patch - merges data into a path with a JSON merge patch
+func (l *logical) Patch(p string, data map[string]interface{}) (*api.Secret, error) {
+	return l.request("PATCH", p, nil, data)
+}
+
+// Delete - deletes a path
+func (l *logical) Delete(p string) (*api.Secret, error) {
+	return l.request("DELETE", p, nil, nil)
+}
+
+// request - makes a request, failing over to the next healthy address when
+// the current address cannot serve it
+func (l *logical) request(
+	method, p string,
+	params map[string][]string,
+	body interface{},
+) (*api.Secret, error) {
+	for {
+		addr := l.client.Address()
+
+		s, status, err := l.retry(method, p, params, body)
+		if err == nil || l.ctx.Err() != nil || (status != 0 && status < 500) {
+			return s, err
+		}
+
+		if !l.failover(addr) {
+			return nil, err
+		}
+	}
+}
+
+// retry - makes a request, retrying until it succeeds, fails with a status
+// which is not retryable, runs out of retries or the step deadline passes
+func (l *logical) retry(
+	method, p string,
+	params map[string][]string,
+	body interface{},
+) (*api.Secret, int, error) {
+	for attempt := 0; ; attempt++ {
+		s, status, err := l.attempt(method, p, params, body)
+		if err == nil {
+			return s, status, nil
+		}
+
+		if attempt >= l.retries || l.ctx.Err() != nil ||
+			(status != 0 && !l.retryable[status]) {
+			return nil, status, err
+		}
+
+		wait := l.backoff(attempt)
+		l.logger.Debug().Err(err).Str("path", p).Int("attempt", attempt+1).
+			Dur("backoff", wait).Msg("retrying request")
+
+		select {
+		case <-time.After(wait):
+		case <-l.ctx.Done():
+			return nil, status, fmt.Errorf("%v: %v", l.ctx.Err(), err)
+		}
+	}
+}
+
+// failover - moves the client from a failed address to the next candidate
+// address, returning false when there are none left. requests which failed
+// concurrently on the same address only fail over once
+func (l *logical) failover(from string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.client.Address() != from {
+		return true
+	}
+
+	for i, addr := range l.addrs {
+		if addr != from || i+1 >= len(l.addrs) {
+			continue
+		}
+
+		next := l.addrs[i+1]
+		if err := l.client.SetAddress(next); err != nil {
+			return false
+		}
+
+		l.logger.Warn().Str("from", from).Str("vault_addr", next).
+			Msg("failing over to next vault address")
+		return true
+	}
+
+	return false
+}
+
+// attempt - makes a single request, returning the status code of any response
+func (l *logical) attempt(
+	method, p string,
+	params map[string][]string,
+	body interface{},
+) (*api.Secret, int, error) {
+	r := l.client.NewRequest(method, "/v1/"+p)
+	if method == "LIST" {
+		r.Method = "GET"
+		r.Params.Set("list", "true")
+	}
+
+	for k, v := range params {
+		r.Params[k] = append(r.Params[k], v...)
+	}
+
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if method == "PATCH" {
+		headers := make(http.Header, len(r.Headers)+1)
+		for k, v := range r.Headers {
+			headers[k] = v
+		}
+		headers.Set("Content-Type", "application/merge-patch+json")
+		r.Headers = headers
+	}
+
+	ctx, cancel := l.requestContext()
+	defer cancel()
+
+	resp, err := l.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+
+	// reading or listing a path which does not exist is not an error
+	if status == 404 && (method == "GET" || method == "LIST") {
+		s, parseErr := api.ParseSecret(resp.Body)
+		switch parseErr {
+		case nil:
+		case io.EOF:
+			return nil, status, nil
+		default:
+			return nil, status, err
+		}
+		if s != nil && (len(s.Warnings) > 0 || len(s.Data) > 0) {
+			return s, status, nil
+		}
+		return nil, status, nil
+	}
+
+	// the api client counts 429 as a success, as vault returns it for the
+	// health of standby nodes, so it and any other retryable status are
+	// failed here rather than parsed as a secret
+	if err == nil && (status == http.StatusTooManyRequests || l.retryable[status]) {
+		err = statusError(resp)
+	}
+
+	if err != nil {
+		return nil, status, err
+	}
+
+	s, err := api.ParseSecret(resp.Body)
+	return s, status, err
+}
+
+// statusError - the error for a response the api client did not fail
+func statusError(resp *api.Response) error {
+	b, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf(
+		"Error making API request.\n\nURL: %s %s\nCode: %d. Raw Message:\n\n%s",
+		resp.Request.Method, resp.Request.URL.String(), resp.StatusCode, b,
+	)
+}
+
+// health - probes the health of an address through a clone of the client, so
+// the address requests are made to is left alone. the health of nodes which
+// cannot serve requests is returned rather than an error
+func (l *logical) health(addr string) (*api.HealthResponse, error) {
+	c, err := l.client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	c.SetHeaders(l.client.Headers())
+
+	if err := c.SetAddress(addr); err != nil {
+		return nil, err
+	}
+
+	r := c.NewRequest("GET", "/v1/sys/health")
+	for _, code := range []string{
+		"uninitcode", "sealedcode", "standbycode",
+		"drsecondarycode", "performancestandbycode",
+	} {
+		r.Params.Set(code, "299")
+	}
+
+	ctx, cancel := l.requestContext()
+	defer cancel()
+
+	resp, err := c.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h api.HealthResponse
+	if err := resp.DecodeJSON(&h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// requestContext - the context of a single request, which times out after
+// request_timeout or at the step deadline, whichever is first
+func (l *logical) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(l.ctx, l.requestTimeout)
+}
+
+// backoff - the exponential backoff, with jitter, before a retry
+func (l *logical) backoff(attempt int) time.Duration {
+	wait := l.minBackoff << uint(attempt)
+	if wait <= 0 || wait > l.maxBackoff {
+		wait = l.maxBackoff
+	}
+
+	// up to a quarter of the wait is jitter
+	if jitter := int64(wait / 4); jitter > 0 {
+		wait = wait - time.Duration(jitter) + time.Duration(rand.Int63n(2*jitter))
+	}
+	if wait > l.maxBackoff {
+		wait = l.maxBackoff
+	}
+
+	return wait
+}
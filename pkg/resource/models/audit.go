@@ -0,0 +1,28 @@
+package models
+
+// Audit - configuration for recording secret access
+type Audit struct {
+	// Sink - where access records are sent, either stderr, file or vault.
+	Sink string `json:"sink"`
+
+	// Path - the file records are appended to for the file sink, or the
+	// path records are written under for the vault sink.
+	Path string `json:"path"`
+}
+
+// AuditRecord - a record of the paths accessed by a step. records never
+// contain secret values
+type AuditRecord struct {
+	Time      string    `json:"time"`
+	Operation string    `json:"operation"`
+	Team      string    `json:"team,omitempty"`
+	Pipeline  string    `json:"pipeline,omitempty"`
+	Job       string    `json:"job,omitempty"`
+	BuildID   string    `json:"build_id,omitempty"`
+	BuildName string    `json:"build_name,omitempty"`
+	BuildURL  string    `json:"build_url,omitempty"`
+	Identity  string    `json:"identity"`
+	Accessor  string    `json:"accessor,omitempty"`
+	VaultAddr string    `json:"vault_addr"`
+	Paths     []Version `json:"paths"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CAS - the check-and-set version of a kv2 write. either a version number, 0
+// to only create a secret which does not exist, or from_input to use the
+// version read by a get step.
+type CAS string
+
+// UnmarshalJSON - accepts a cas given as a number or a string
+func (c *CAS) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*c = ""
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		*c = CAS(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*c = CAS(s)
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+// Generate - parameters for generating a secret value on put
+type Generate struct {
+	// Key - the key the generated value is written to.
+	Key string `json:"key"`
+
+	// Policy - the name of a vault password policy to generate the value
+	// with. When empty the value is generated by the resource.
+	Policy string `json:"policy"`
+
+	// Length - the length of a value generated by the resource.
+	Length int `json:"length"`
+
+	// Charset - the characters a value generated by the resource is made
+	// of.
+	Charset string `json:"charset"`
+
+	// MinLowercase - the minimum number of lowercase letters.
+	MinLowercase int `json:"min_lowercase"`
+
+	// MinUppercase - the minimum number of uppercase letters.
+	MinUppercase int `json:"min_uppercase"`
+
+	// MinDigits - the minimum number of digits.
+	MinDigits int `json:"min_digits"`
+
+	// MinSymbols - the minimum number of characters which are not letters or
+	// digits.
+	MinSymbols int `json:"min_symbols"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Lease - a lease on a dynamic secret issued by vault
+type Lease struct {
+	// Path - the path the secret was read from
+	Path string `json:"path"`
+	// LeaseID - the id of the lease
+	LeaseID string `json:"lease_id"`
+	// LeaseDuration - the ttl of the lease in seconds
+	LeaseDuration int `json:"lease_duration"`
+	// Renewable - whether the lease can be renewed
+	Renewable bool `json:"renewable"`
+}
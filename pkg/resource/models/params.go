@@ -0,0 +1,67 @@
+package models
+
+// Params - parameters for get and put steps
+type Params struct {
+	// Action - delete, undelete, destroy or delete_metadata to remove the
+	// secret at path, or restore its versions, instead of writing it.
+	Action string `json:"action"`
+
+	// CAS - the check-and-set version the secret at path must be at to be
+	// written.
+	CAS CAS `json:"cas"`
+
+	// Confirm - confirms an action which removes secrets.
+	Confirm bool `json:"confirm"`
+
+	// Data - the data written to path.
+	Data map[string]interface{} `json:"data"`
+
+	// DataFile - a JSON or YAML file, relative to the sources directory, of
+	// the data written to path.
+	DataFile string `json:"data_file"`
+
+	// DryRun - report what an action would remove without removing it.
+	DryRun bool `json:"dry_run"`
+
+	// Generate - generate a value for a key of the data written to path.
+	Generate Generate `json:"generate"`
+
+	// Increment - the requested extension of renewed leases in seconds.
+	Increment int `json:"increment"`
+
+	// Method - either write to replace the secret at path or patch to merge
+	// data into it. keys set to null are removed by a patch.
+	Method string `json:"method"`
+
+	// Path - the path of a kv secret to write.
+	Path string `json:"path"`
+
+	// RenewLeasesFrom - a directory containing a leases file written by a get
+	// step whose leases should be renewed.
+	RenewLeasesFrom string `json:"renew_leases_from"`
+
+	// RevokeLeasesFrom - a directory containing a leases file written by a get
+	// step whose leases should be revoked.
+	RevokeLeasesFrom string `json:"revoke_leases_from"`
+
+	// RollbackTo - roll the kv2 secret at path back to a version by writing
+	// its data as a new version.
+	RollbackTo RollbackTo `json:"rollback_to"`
+
+	// SSH - sign a public key with the ssh secrets engine.
+	SSH SSHParams `json:"ssh"`
+
+	// Transit - encrypt or decrypt files with the transit secrets engine.
+	Transit TransitParams `json:"transit"`
+
+	// Versions - the kv2 versions an action applies to.
+	Versions []int `json:"versions"`
+
+	// VersionsFrom - a directory containing a versions file written by a get
+	// step, whose versions are used when cas is from_input.
+	VersionsFrom string `json:"versions_from"`
+
+	// WriteVersions - a get step writes the versions of the kv2 secrets it
+	// reads to a versions file.
+	WriteVersions bool `json:"write_versions"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// PKI - configuration for issuing certificates in pki mode
+type PKI struct {
+	// Mount - the path the pki secrets engine is mounted at.
+	Mount string `json:"mount"`
+
+	// Role - the role to issue certificates against.
+	Role string `json:"role"`
+
+	// CommonName - the common name of the certificate.
+	CommonName string `json:"common_name"`
+
+	// AltNames - the DNS subject alternative names of the certificate.
+	AltNames []string `json:"alt_names"`
+
+	// IPSANs - the IP subject alternative names of the certificate.
+	IPSANs []string `json:"ip_sans"`
+
+	// TTL - the requested lifetime of the certificate, e.g. 720h.
+	TTL string `json:"ttl"`
+
+	// RenewBefore - how long before the certificate expires a new version is
+	// reported by check, e.g. 168h. Defaults to a third of the ttl.
+	RenewBefore string `json:"renew_before"`
+}
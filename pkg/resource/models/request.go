@@ -4,4 +4,5 @@ package models
 type Request struct {
 	Source  Source  `json:"source"`
 	Version Version `json:"version"`
+	Params  Params  `json:"params"`
 }
@@ -0,0 +1,16 @@
+package models
+
+// RollbackTo - the kv2 version a secret is rolled back to. either a version
+// number or previous for the newest readable version before the current one.
+type RollbackTo string
+
+// UnmarshalJSON - accepts a version given as a number or a string
+func (t *RollbackTo) UnmarshalJSON(b []byte) error {
+	var c CAS
+	if err := c.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	*t = RollbackTo(c)
+
+	return nil
+}
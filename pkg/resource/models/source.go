@@ -2,15 +2,75 @@ package models
 
 // Source - source configuration for the resource
 type Source struct {
-	// VaultPaths - the path(s) to the secrets in vault.
+	// VaultPaths - the path(s) to the secrets in vault. paths may be glob
+	// patterns.
 	VaultPaths map[string]int `json:"vault_paths"`
 
+	// Agent - authenticate through the auto-auth token of a vault agent
+	// listening at vault_addr rather than a token.
+	Agent bool `json:"agent"`
+
+	// Audit - where records of the paths accessed by each step are sent.
+	Audit Audit `json:"audit"`
+
+	// CheckMetadata - the kv2 custom_metadata keys folded into versions and
+	// written to the metadata file.
+	CheckMetadata []string `json:"check_metadata"`
+
+	// ChildToken - create a child token carrying the build metadata for each
+	// step.
+	ChildToken bool `json:"child_token"`
+
+	// ChildTokenTTL - the ttl of child tokens, e.g. 1h.
+	ChildTokenTTL string `json:"child_token_ttl"`
+
+	// Concurrency - the maximum number of paths read at once.
+	Concurrency int `json:"concurrency"`
+
 	// Format - the desired output format. Supported formats are yaml or json.
 	Format string `json:"format"`
 
+	// FileMode - the octal permissions of the written secrets file.
+	FileMode string `json:"file_mode"`
+
+	// FlattenSeparator - the separator used to join nested keys when flattening.
+	FlattenSeparator string `json:"flatten_separator"`
+
+	// MaxPaths - the maximum number of paths vault_paths patterns may match.
+	MaxPaths int `json:"max_paths"`
+
+	// MaxVersions - the maximum number of versions of a kv2 secret a check
+	// reports.
+	MaxVersions int `json:"max_versions"`
+
+	// MaxBackoff - the longest wait between retries, e.g. 10s.
+	MaxBackoff string `json:"max_backoff"`
+
+	// MinBackoff - the wait before the first retry, which doubles with each
+	// retry up to max_backoff, e.g. 1s.
+	MinBackoff string `json:"min_backoff"`
+
+	// Mode - the mode of the resource. Supported modes are kv, pki or ssh.
+	Mode string `json:"mode"`
+
+	// PKI - configuration for issuing certificates in pki mode.
+	PKI PKI `json:"pki"`
+
+	// NoProxy - a comma separated list of hosts which are not proxied.
+	NoProxy string `json:"no_proxy"`
+
 	// Prefix - a desired prefix to prepend to a secret key.
 	Prefix string `json:"prefix"`
 
+	// ProxyURL - the url of the proxy requests to vault are made through.
+	ProxyURL string `json:"proxy_url"`
+
+	// RequestTimeout - the timeout of each request to vault, e.g. 30s.
+	RequestTimeout string `json:"request_timeout"`
+
+	// RetryableStatuses - the response status codes which are retried.
+	RetryableStatuses []int `json:"retryable_statuses"`
+
 	// RoleID - the role_id for approle authentication.
 	RoleID string `json:"role_id"`
 
@@ -20,9 +80,25 @@ type Source struct {
 	// SecretID - the secret_id for approle authentication.
 	SecretID string `json:"secret_id"`
 
-	// VaultAddr - the address to the vault server.
+	// SSH - configuration for signing keys in ssh mode.
+	SSH SSH `json:"ssh"`
+
+	// SecretsFile - the name of the file secrets are written to.
+	SecretsFile string `json:"secrets_file"`
+
+	// Timeout - the deadline for all requests made by a step, e.g. 5m.
+	Timeout string `json:"timeout"`
+
+	// TransitDecrypt - the transit key used to decrypt ciphertext values.
+	TransitDecrypt Transit `json:"transit_decrypt"`
+
+	// VaultAddr - the address to the vault server. unix:// addresses connect
+	// to a unix socket.
 	VaultAddr string `json:"vault_addr"`
 
+	// VaultAddrs - the addresses of vault servers in order of preference.
+	VaultAddrs []string `json:"vault_addrs"`
+
 	// VaultToken - the token to use to authenticate to vault.
 	VaultToken string `json:"vault_token"`
 
@@ -32,6 +108,13 @@ type Source struct {
 	// Debug - enable debug logging.
 	Debug bool `json:"debug"`
 
+	// FallbackToReadable - read the newest readable version of a kv2 secret
+	// when the version requested is deleted or destroyed.
+	FallbackToReadable bool `json:"fallback_to_readable"`
+
+	// Flatten - flatten nested maps and lists into top level keys.
+	Flatten bool `json:"flatten"`
+
 	// Sanitize - convert dashes and dots to underscores in vault keys.
 	Sanitize bool `json:"sanitize"`
 
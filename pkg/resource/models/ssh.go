@@ -0,0 +1,30 @@
+package models
+
+// SSH - configuration for signing keys in ssh mode
+type SSH struct {
+	// Mount - the path the ssh secrets engine is mounted at.
+	Mount string `json:"mount"`
+
+	// Role - the role to sign keys against.
+	Role string `json:"role"`
+
+	// Principals - the principals the certificate is valid for.
+	Principals []string `json:"principals"`
+
+	// CertType - the type of certificate to issue, user or host.
+	CertType string `json:"cert_type"`
+
+	// TTL - the requested lifetime of the certificate, e.g. 1h.
+	TTL string `json:"ttl"`
+
+	// RenewBefore - how long before the certificate expires a new version is
+	// reported by check, e.g. 10m. Defaults to a third of the ttl.
+	RenewBefore string `json:"renew_before"`
+}
+
+// SSHParams - parameters for signing a public key on put
+type SSHParams struct {
+	// PublicKey - the path to the public key to sign, relative to the sources
+	// directory.
+	PublicKey string `json:"public_key"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Transit - a key in the transit secrets engine
+type Transit struct {
+	// Mount - the path the transit secrets engine is mounted at.
+	Mount string `json:"mount"`
+
+	// Key - the name of the transit key.
+	Key string `json:"key"`
+}
+
+// TransitParams - parameters for encrypting or decrypting files on put
+type TransitParams struct {
+	Transit
+
+	// Action - either encrypt or decrypt.
+	Action string `json:"action"`
+
+	// Files - glob patterns of the files to encrypt or decrypt, relative to
+	// the sources directory.
+	Files []string `json:"files"`
+
+	// Destination - the directory, relative to the sources directory, results
+	// are written to. Defaults to the directory of each file.
+	Destination string `json:"destination"`
+}
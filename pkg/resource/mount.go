@@ -0,0 +1,87 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// dynamicEngines - secrets engines which issue leased, dynamic credentials
+var dynamicEngines = map[string]bool{
+	"ad":           true,
+	"alicloud":     true,
+	"aws":          true,
+	"azure":        true,
+	"consul":       true,
+	"database":     true,
+	"gcp":          true,
+	"mongodbatlas": true,
+	"nomad":        true,
+	"rabbitmq":     true,
+}
+
+// mount - a secrets engine mount as reported by vault
+type mount struct {
+	Path      string
+	Type      string
+	KVVersion int
+}
+
+// dynamic - whether the mount issues leased, dynamic credentials
+func (m mount) dynamic() bool {
+	return dynamicEngines[m.Type]
+}
+
+// mountInfo - looks up the secrets engine mount serving a path
+func (r Resource) mountInfo(p string) (*mount, error) {
+	s, err := r.logical.Read(
+		fmt.Sprintf("sys/internal/ui/mounts/%s", strings.TrimPrefix(p, "/")),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil || s.Data == nil {
+		return nil, fmt.Errorf("no mount found for path %s", p)
+	}
+
+	m := &mount{}
+	m.Path, _ = s.Data["path"].(string)
+	m.Type, _ = s.Data["type"].(string)
+	if len(m.Type) <= 0 {
+		return nil, errors.New("no mount type returned")
+	}
+
+	if options, ok := s.Data["options"].(map[string]interface{}); ok {
+		if v, ok := options["version"]; ok {
+			fmt.Sscanf(fmt.Sprintf("%v", v), "%d", &m.KVVersion)
+		}
+	}
+
+	if (m.Type == "kv" || m.Type == "generic") && m.KVVersion <= 0 {
+		m.KVVersion = 1
+	}
+
+	return m, nil
+}
+
+// kv2Endpoints - the endpoints of a kv2 mount which prefix secret names
+var kv2Endpoints = []string{"data", "metadata", "delete", "undelete", "destroy"}
+
+// kv2Name - the name of a secret on a kv2 mount, without the mount path or an
+// endpoint
+func kv2Name(m *mount, p string) string {
+	name := strings.Trim(strings.TrimPrefix(strings.Trim(p, "/"), strings.Trim(m.Path, "/")), "/")
+	for _, e := range kv2Endpoints {
+		if strings.HasPrefix(name, e+"/") {
+			return strings.TrimPrefix(name, e+"/")
+		}
+	}
+	return name
+}
+
+// kv2Path - the path of a secret on a kv2 mount at an endpoint such as data or
+// metadata, whether or not p already includes an endpoint
+func kv2Path(m *mount, p, endpoint string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.Trim(m.Path, "/"), endpoint, kv2Name(m, p))
+}
@@ -0,0 +1,22 @@
+package resource
+
+// Option - configures a Resource
+type Option func(*Resource)
+
+// WithRedactor - sets the Redactor the logger writes through, so that secret
+// values seen by the resource are scrubbed from its logs. without it the
+// resource logs to stderr through a Redactor of its own
+func WithRedactor(rd *Redactor) Option {
+	return func(r *Resource) {
+		r.redactor = rd
+	}
+}
+
+// WithLogical - sets the Logical requests to vault are made through, in place
+// of the client built from the source configuration, so the resource can be
+// exercised without a vault server
+func WithLogical(l Logical) Option {
+	return func(r *Resource) {
+		r.logical = l
+	}
+}
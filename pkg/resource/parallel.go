@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"sort"
+	"sync"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// parallel - calls fn for each index below n with at most limit calls in
+// flight. every call is made, and the errors of all failed calls are returned
+// together in index order
+func parallel(n, limit int, fn func(i int) error) error {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, n)
+		sem  = make(chan struct{}, limit)
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	var result *multierror.Error
+	for _, err := range errs {
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// sortedPaths - the paths of a vault_paths map in lexical order
+func sortedPaths(paths map[string]int) []string {
+	names := make([]string, 0, len(paths))
+	for p := range paths {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedPatterns - the patterns of an expanded vault_paths map in lexical order
+func sortedPatterns(patterns map[string][]string) []string {
+	names := make([]string, 0, len(patterns))
+	for p := range patterns {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
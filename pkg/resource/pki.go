@@ -0,0 +1,209 @@
+package resource
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// the files written when issuing a certificate
+const (
+	certificateFile = "certificate.pem"
+	privateKeyFile  = "private_key.pem"
+	caChainFile     = "ca_chain.pem"
+	serialFile      = "serial"
+)
+
+// pkiPath - the path certificates are issued from
+func (r Resource) pkiPath() string {
+	return fmt.Sprintf(
+		"%s/issue/%s",
+		strings.Trim(r.config.Source.PKI.Mount, "/"),
+		r.config.Source.PKI.Role,
+	)
+}
+
+// checkPKI - reports a new version once the last issued certificate is
+// within its renewal window
+func (r Resource) checkPKI() []models.Version {
+	ttl, _ := time.ParseDuration(r.config.Source.PKI.TTL)
+	renewBefore, _ := time.ParseDuration(r.config.Source.PKI.RenewBefore)
+
+	return checkRenewal(r.config.Version, r.pkiPath(), ttl, renewBefore)
+}
+
+// checkRenewal - versions of short lived credentials are the unix time they
+// are issued at. the last version is reported until the credential issued for
+// it comes within renewBefore of expiring, and its successor is issued at the
+// time it became due, so that every step fetching it agrees on its lifetime
+func checkRenewal(last models.Version, path string, ttl, renewBefore time.Duration) []models.Version {
+	now := time.Now().UTC()
+
+	issued, err := strconv.ParseInt(last.Version, 10, 64)
+	if err != nil || last.Path != path {
+		return []models.Version{{Path: path, Version: fmt.Sprintf("%d", now.Unix())}}
+	}
+
+	due := time.Unix(issued, 0).Add(ttl - renewBefore)
+	if now.Before(due) {
+		return []models.Version{last}
+	}
+
+	// a successor which would itself be due for renewal is issued now
+	if !now.Before(due.Add(ttl - renewBefore)) {
+		due = now
+	}
+
+	return []models.Version{{Path: path, Version: fmt.Sprintf("%d", due.Unix())}}
+}
+
+// issueTime - the issue time of the version being fetched. a certificate
+// expires ttl after the version it is issued for, so the version must not be
+// in the future or already have expired
+func (r Resource) issueTime(path string, ttl time.Duration) (time.Time, error) {
+	now := time.Now().UTC()
+	if r.config.Version.Path != path || len(r.config.Version.Version) <= 0 {
+		return now, nil
+	}
+
+	issued, err := strconv.ParseInt(r.config.Version.Version, 10, 64)
+	if err != nil {
+		return now, fmt.Errorf("version %s is not an issue time", r.config.Version.Version)
+	}
+
+	t := time.Unix(issued, 0).UTC()
+	if t.After(now.Add(time.Minute)) {
+		return now, fmt.Errorf("version %s is issued in the future, at %s", r.config.Version.Version, t.Format(time.RFC3339))
+	}
+
+	if !now.Before(t.Add(ttl)) {
+		return now, fmt.Errorf(
+			"version %s expired at %s, run check for a newer version",
+			r.config.Version.Version, t.Add(ttl).Format(time.RFC3339),
+		)
+	}
+
+	return t, nil
+}
+
+// issueCertificate - issues a certificate and writes it, its private key, the
+// ca chain and its serial number to the working directory
+func (r *Resource) issueCertificate() (models.Metadata, error) {
+	pki := r.config.Source.PKI
+
+	ttl, _ := time.ParseDuration(pki.TTL)
+	issued, err := r.issueTime(r.pkiPath(), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	// every certificate issued for a version expires at the same time, so
+	// pki.ttl is sent as a not_after counted from the version rather than as
+	// a ttl counted from now
+	notAfter := issued.Add(ttl).Truncate(time.Second)
+	data := map[string]interface{}{
+		"common_name": pki.CommonName,
+		"not_after":   notAfter.UTC().Format(time.RFC3339),
+	}
+	if len(pki.AltNames) > 0 {
+		data["alt_names"] = strings.Join(pki.AltNames, ",")
+	}
+	if len(pki.IPSANs) > 0 {
+		data["ip_sans"] = strings.Join(pki.IPSANs, ",")
+	}
+
+	s, err := r.logical.Write(r.pkiPath(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil || s.Data == nil {
+		return nil, errors.New("no certificate returned")
+	}
+
+	certificate, _ := s.Data["certificate"].(string)
+	privateKey, _ := s.Data["private_key"].(string)
+	serial, _ := s.Data["serial_number"].(string)
+	if len(certificate) <= 0 || len(privateKey) <= 0 {
+		return nil, errors.New("no certificate or private key returned")
+	}
+	r.redactor.Add(privateKey)
+
+	if err := r.validateCertificate(certificate, notAfter); err != nil {
+		return nil, err
+	}
+
+	var chain []string
+	if c, ok := s.Data["ca_chain"].([]interface{}); ok {
+		for _, v := range c {
+			chain = append(chain, fmt.Sprintf("%v", v))
+		}
+	}
+	if len(chain) <= 0 {
+		if ca, ok := s.Data["issuing_ca"].(string); ok {
+			chain = append(chain, ca)
+		}
+	}
+
+	files := []struct {
+		name string
+		data string
+	}{
+		{certificateFile, certificate},
+		{privateKeyFile, privateKey},
+		{caChainFile, strings.Join(chain, "\n")},
+		{serialFile, serial},
+	}
+	for _, f := range files {
+		mode := r.fileMode()
+		if f.name == privateKeyFile {
+			mode = 0600
+		}
+
+		if err := r.writeFile(f.name, []byte(f.data+"\n"), mode); err != nil {
+			return nil, err
+		}
+	}
+
+	r.logger.Debug().Str("serial", serial).Msg("issued certificate")
+	r.access(r.pkiPath(), serial)
+
+	return models.Metadata{
+		{Key: "common_name", Value: pki.CommonName},
+		{Key: "serial", Value: serial},
+		{Key: "issued", Value: issued.Format(time.RFC3339)},
+		{Key: "expiration", Value: notAfter.Format(time.RFC3339)},
+	}, nil
+}
+
+// validateCertificate - checks an issued certificate expires when its version
+// says it should. vault caps the lifetime of certificates at the max_ttl of
+// the role, which would leave steps fetching the same version with
+// certificates expiring at different times
+func (r Resource) validateCertificate(certificate string, notAfter time.Time) error {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return errors.New("certificate returned is not PEM encoded")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing certificate returned: %v", err)
+	}
+
+	if !cert.NotAfter.Equal(notAfter) {
+		return fmt.Errorf(
+			"certificate returned expires at %s rather than %s, check the max_ttl of role %s",
+			cert.NotAfter.UTC().Format(time.RFC3339), notAfter.Format(time.RFC3339),
+			r.config.Source.PKI.Role,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted - replaces secret values in redacted output
+const redacted = "[redacted]"
+
+// the smallest values nested in secrets which are redacted. shorter strings
+// and smaller numbers, such as ports, ttls and flags, appear throughout log
+// lines, so redacting them would corrupt the output without hiding anything
+const (
+	minRedactLength = 4
+	minRedactNumber = 100000
+)
+
+// Redactor - an io.Writer which scrubs secret values from everything written
+// through it. every log line written by the resource passes through a
+// Redactor, so values never reach stderr, including values echoed back in
+// errors from the vault api
+type Redactor struct {
+	mu       sync.RWMutex
+	w        io.Writer
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewRedactor - returns a Redactor writing to w
+func NewRedactor(w io.Writer) *Redactor {
+	return &Redactor{
+		w:      w,
+		values: make(map[string]bool, 0),
+	}
+}
+
+// Add - adds secret values to be redacted. values are redacted both as they
+// are and as they appear escaped in json
+func (rd *Redactor) Add(values ...string) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	for _, v := range values {
+		if len(v) <= 0 {
+			continue
+		}
+		rd.values[v] = true
+
+		if b, err := json.Marshal(v); err == nil {
+			if escaped := string(b[1 : len(b)-1]); len(escaped) > 0 {
+				rd.values[escaped] = true
+			}
+		}
+	}
+	rd.replacer = nil
+}
+
+// AddValue - adds every string or number nested in a secret value, skipping
+// short strings, small numbers and bools
+func (rd *Redactor) AddValue(value interface{}) {
+	switch t := value.(type) {
+	case string:
+		if len(t) >= minRedactLength {
+			rd.Add(t)
+		}
+	case json.Number:
+		if f, err := t.Float64(); err != nil || math.Abs(f) >= minRedactNumber {
+			rd.Add(t.String())
+		}
+	case float64:
+		if math.Abs(t) >= minRedactNumber {
+			rd.Add(fmt.Sprintf("%v", t))
+		}
+	case int:
+		if math.Abs(float64(t)) >= minRedactNumber {
+			rd.Add(fmt.Sprintf("%v", t))
+		}
+	case int64:
+		if math.Abs(float64(t)) >= minRedactNumber {
+			rd.Add(fmt.Sprintf("%v", t))
+		}
+	case map[string]interface{}:
+		for _, v := range t {
+			rd.AddValue(v)
+		}
+	case []interface{}:
+		for _, v := range t {
+			rd.AddValue(v)
+		}
+	}
+}
+
+// Redact - returns s with every secret value replaced
+func (rd *Redactor) Redact(s string) string {
+	return rd.getReplacer().Replace(s)
+}
+
+// Write - writes p to the underlying writer with every secret value replaced
+func (rd *Redactor) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rd.w, rd.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// getReplacer - returns a replacer for the current values, longest first so
+// that a value containing another value is redacted whole
+func (rd *Redactor) getReplacer() *strings.Replacer {
+	rd.mu.RLock()
+	replacer := rd.replacer
+	rd.mu.RUnlock()
+	if replacer != nil {
+		return replacer
+	}
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	values := make([]string, 0, len(rd.values))
+	for v := range rd.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, redacted)
+	}
+	rd.replacer = strings.NewReplacer(pairs...)
+
+	return rd.replacer
+}
@@ -0,0 +1,143 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// the actions which remove kv secrets, or restore removed versions
+const (
+	actionDelete         = "delete"
+	actionUndelete       = "undelete"
+	actionDestroy        = "destroy"
+	actionDeleteMetadata = "delete_metadata"
+)
+
+// joinVersions - a comma separated list of versions
+func joinVersions(versions []int) string {
+	s := make([]string, len(versions))
+	for i, v := range versions {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// affectedVersions - the versions of the kv2 secret at p an action applies
+// to. a delete without versions applies to the current version and a
+// delete_metadata to every version
+func (r Resource) affectedVersions(m *mount, p string) ([]int, error) {
+	if len(r.config.Params.Versions) > 0 {
+		return r.config.Params.Versions, nil
+	}
+
+	s, err := r.logical.Read(kv2Path(m, p, "metadata"))
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil || s.Data == nil {
+		return nil, fmt.Errorf("%s does not exist", p)
+	}
+
+	if r.config.Params.Action == actionDelete {
+		var current int
+		fmt.Sscanf(fmt.Sprintf("%v", s.Data["current_version"]), "%d", &current)
+		return []int{current}, nil
+	}
+
+	var versions []int
+	for _, v := range kv2Versions(s) {
+		versions = append(versions, v.Version)
+	}
+
+	return versions, nil
+}
+
+// removeSecret - deletes, undeletes or destroys versions of the kv secret at
+// path, or deletes its metadata and every version with it. a dry run only
+// reports what would be removed
+func (r *Resource) removeSecret() (models.Version, models.Metadata, error) {
+	var (
+		a      = r.config.Params.Action
+		p      = r.config.Params.Path
+		dryRun = r.config.Params.DryRun
+	)
+	version := models.Version{
+		Path:    p,
+		Version: fmt.Sprintf("%d", time.Now().UTC().Unix()),
+	}
+
+	m, err := r.mountInfo(p)
+	if err != nil {
+		return version, nil, fmt.Errorf("error looking up the mount of %s: %v", p, err)
+	}
+
+	if m.KVVersion != 2 {
+		if a != actionDelete || len(r.config.Params.Versions) > 0 {
+			return version, nil, fmt.Errorf("%s of versions is only supported on kv2 mounts, %s is not one", a, p)
+		}
+
+		metadata := models.Metadata{
+			{Key: "path", Value: p},
+			{Key: "action", Value: a},
+			{Key: "dry_run", Value: strconv.FormatBool(dryRun)},
+		}
+		if dryRun {
+			r.logger.Info().Str("path", p).Msg("dry run, would delete secret")
+			return version, metadata, nil
+		}
+
+		if _, err := r.logical.Delete(p); err != nil {
+			return version, nil, fmt.Errorf("error deleting %s: %v", p, err)
+		}
+		r.access(p, "")
+		r.logger.Info().Str("path", p).Msg("deleted secret")
+
+		return version, metadata, nil
+	}
+
+	p = kv2Path(m, p, "data")
+	version.Path = p
+
+	versions, err := r.affectedVersions(m, p)
+	if err != nil {
+		return version, nil, err
+	}
+
+	metadata := models.Metadata{
+		{Key: "path", Value: p},
+		{Key: "action", Value: a},
+		{Key: "versions", Value: joinVersions(versions)},
+		{Key: "dry_run", Value: strconv.FormatBool(dryRun)},
+	}
+
+	if dryRun {
+		r.logger.Info().Str("path", p).Ints("versions", versions).
+			Msgf("dry run, would %s", strings.Replace(a, "_", " ", -1))
+		return version, metadata, nil
+	}
+
+	switch {
+	case a == actionDeleteMetadata:
+		_, err = r.logical.Delete(kv2Path(m, p, "metadata"))
+	case a == actionDelete && len(r.config.Params.Versions) <= 0:
+		_, err = r.logical.Delete(p)
+	default:
+		_, err = r.logical.Write(kv2Path(m, p, a), map[string]interface{}{
+			"versions": versions,
+		})
+	}
+	if err != nil {
+		return version, nil, fmt.Errorf("error running %s on %s: %v", a, p, err)
+	}
+
+	r.access(p, joinVersions(versions))
+	r.logger.Info().Str("path", p).Ints("versions", versions).
+		Msgf("%s complete", strings.Replace(a, "_", " ", -1))
+
+	return version, metadata, nil
+}
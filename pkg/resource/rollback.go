@@ -0,0 +1,133 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// rollbackPrevious - rolls back to the newest readable version before the
+// current one
+const rollbackPrevious = "previous"
+
+// rollbackVersion - the version of a kv2 secret rollback_to refers to, given
+// its versions and current version
+func (r Resource) rollbackVersion(p string, versions []kv2Version, current int) (int, error) {
+	to := string(r.config.Params.RollbackTo)
+	if to == rollbackPrevious {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Version < current && len(versions[i].unreadable()) <= 0 {
+				return versions[i].Version, nil
+			}
+		}
+		return 0, fmt.Errorf("%s has no readable version before version %d", p, current)
+	}
+
+	n, err := strconv.Atoi(to)
+	if err != nil {
+		return 0, err
+	}
+
+	if n == current {
+		return 0, fmt.Errorf("version %d is already the current version of %s", n, p)
+	}
+
+	for _, v := range versions {
+		if v.Version != n {
+			continue
+		}
+		if reason := v.unreadable(); len(reason) > 0 {
+			return 0, fmt.Errorf("version %d %s", n, reason)
+		}
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("version %d of %s does not exist", n, p)
+}
+
+// rollbackSecret - rolls the kv2 secret at path back to an earlier version,
+// writing that version's data as a new version with a cas of the current
+// version, or of cas when it is set
+func (r *Resource) rollbackSecret() (models.Version, models.Metadata, error) {
+	p := r.config.Params.Path
+	version := models.Version{Path: p}
+
+	m, err := r.mountInfo(p)
+	if err != nil {
+		return version, nil, fmt.Errorf("error looking up the mount of %s: %v", p, err)
+	}
+
+	if m.KVVersion != 2 {
+		return version, nil, fmt.Errorf("rollback_to is only supported on kv2 mounts, %s is not one", p)
+	}
+
+	p = kv2Path(m, p, "data")
+	version.Path = p
+
+	meta, err := r.logical.Read(kv2Path(m, p, "metadata"))
+	if err != nil {
+		return version, nil, fmt.Errorf("error reading the metadata of %s: %v", p, err)
+	}
+
+	if meta == nil || meta.Data == nil {
+		return version, nil, fmt.Errorf("%s does not exist", p)
+	}
+
+	var current int
+	fmt.Sscanf(fmt.Sprintf("%v", meta.Data["current_version"]), "%d", &current)
+
+	to, err := r.rollbackVersion(p, kv2Versions(meta), current)
+	if err != nil {
+		return version, nil, fmt.Errorf("error rolling back %s: %v", p, err)
+	}
+
+	s, err := r.readPath(p, to)
+	if err != nil {
+		return version, nil, fmt.Errorf("error reading version %d of %s: %v", to, p, err)
+	}
+
+	if s == nil || s.Data == nil {
+		return version, nil, fmt.Errorf("version %d of %s does not exist", to, p)
+	}
+
+	data, _ := s.Data["data"].(map[string]interface{})
+	r.redactor.AddValue(data)
+	r.access(p, strconv.Itoa(to))
+
+	cas, checked, err := r.casVersion(m, p)
+	if err != nil {
+		return version, nil, err
+	}
+	if !checked {
+		cas = current
+	}
+
+	s, err = r.logical.Write(p, map[string]interface{}{
+		"data":    data,
+		"options": map[string]interface{}{"cas": cas},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), casMismatch) {
+			return version, nil, r.casConflict(m, p, cas)
+		}
+		return version, nil, fmt.Errorf("error writing %s: %v", p, err)
+	}
+
+	if s == nil || s.Data == nil {
+		return version, nil, fmt.Errorf("no version returned writing %s", p)
+	}
+
+	version.Version = fmt.Sprintf("%v", s.Data["version"])
+	r.access(p, version.Version)
+	r.logger.Info().Str("path", p).Int("rolled_back_to", to).
+		Str("version", version.Version).Msg("rolled back secret")
+
+	return version, models.Metadata{
+		{Key: "path", Value: p},
+		{Key: "version", Value: version.Version},
+		{Key: "rolled_back_to", Value: strconv.Itoa(to)},
+		{Key: "replaced", Value: strconv.Itoa(current)},
+	}, nil
+}
@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// the files written when signing an ephemeral key pair
+const (
+	sshPrivateKeyFile  = "id_rsa"
+	sshPublicKeyFile   = "id_rsa.pub"
+	sshCertificateFile = "id_rsa-cert.pub"
+)
+
+// sshKeyBits - the size of generated rsa keys
+const sshKeyBits = 4096
+
+// sshPath - the path keys are signed at
+func (r Resource) sshPath() string {
+	return fmt.Sprintf(
+		"%s/sign/%s",
+		strings.Trim(r.config.Source.SSH.Mount, "/"),
+		r.config.Source.SSH.Role,
+	)
+}
+
+// checkSSH - reports a new version once the last signed certificate is
+// within its renewal window
+func (r Resource) checkSSH() []models.Version {
+	ttl, _ := time.ParseDuration(r.config.Source.SSH.TTL)
+	renewBefore, _ := time.ParseDuration(r.config.Source.SSH.RenewBefore)
+
+	return checkRenewal(r.config.Version, r.sshPath(), ttl, renewBefore)
+}
+
+// sign - signs an openssh public key, returning the certificate and its serial
+func (r Resource) sign(publicKey []byte) (string, string, error) {
+	config := r.config.Source.SSH
+
+	data := map[string]interface{}{
+		"public_key": strings.TrimSpace(string(publicKey)),
+		"cert_type":  config.CertType,
+		"ttl":        config.TTL,
+	}
+	if len(config.Principals) > 0 {
+		data["valid_principals"] = strings.Join(config.Principals, ",")
+	}
+
+	s, err := r.logical.Write(r.sshPath(), data)
+	if err != nil {
+		return "", "", err
+	}
+
+	if s == nil || s.Data == nil {
+		return "", "", errors.New("no signed key returned")
+	}
+
+	signed, ok := s.Data["signed_key"].(string)
+	if !ok || len(signed) <= 0 {
+		return "", "", errors.New("no signed key returned")
+	}
+	serial, _ := s.Data["serial_number"].(string)
+
+	return signed, serial, nil
+}
+
+// signKeyPair - generates an ephemeral key pair, signs its public key and
+// writes the private key, public key and certificate to the working directory
+func (r *Resource) signKeyPair() (models.Metadata, error) {
+	key, err := rsa.GenerateKey(rand.Reader, sshKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ssh key: %v", err)
+	}
+
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding ssh public key: %v", err)
+	}
+	publicKey := ssh.MarshalAuthorizedKey(pub)
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	r.redactor.Add(string(privateKey))
+
+	signed, serial, err := r.sign(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{sshPrivateKeyFile, privateKey, 0600},
+		{sshPublicKeyFile, publicKey, r.fileMode()},
+		{sshCertificateFile, []byte(signed), 0600},
+	}
+	for _, f := range files {
+		if err := r.writeFile(f.name, f.data, f.mode); err != nil {
+			return nil, err
+		}
+	}
+
+	r.logger.Debug().Str("serial", serial).Msg("signed ssh key")
+	r.access(r.sshPath(), serial)
+
+	return r.sshMetadata(serial), nil
+}
+
+// signPublicKey - signs the public key named in the put params and writes the
+// certificate next to it following the openssh <name>-cert.pub convention
+func (r *Resource) signPublicKey() (models.Metadata, error) {
+	p := r.config.Params.SSH.PublicKey
+
+	src, err := r.workPath(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh.public_key: %v", err)
+	}
+
+	publicKey, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key %s: %v", p, err)
+	}
+
+	signed, serial, err := r.sign(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := fmt.Sprintf("%s-cert.pub", strings.TrimSuffix(p, ".pub"))
+	if err := r.writeFile(cert, []byte(signed), 0600); err != nil {
+		return nil, err
+	}
+
+	r.logger.Debug().Str("serial", serial).Str("certificate", cert).
+		Msg("signed ssh key")
+	r.access(r.sshPath(), serial)
+
+	return append(r.sshMetadata(serial), models.MetadataKvP{
+		Key:   "certificate",
+		Value: cert,
+	}), nil
+}
+
+// sshMetadata - metadata describing a signed certificate
+func (r Resource) sshMetadata(serial string) models.Metadata {
+	return models.Metadata{
+		{Key: "serial", Value: serial},
+		{Key: "principals", Value: strings.Join(r.config.Source.SSH.Principals, ",")},
+		{Key: "ttl", Value: r.config.Source.SSH.TTL},
+	}
+}
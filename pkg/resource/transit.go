@@ -0,0 +1,215 @@
+package resource
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// ciphertextPrefix - the prefix of every transit ciphertext
+const ciphertextPrefix = "vault:v"
+
+// ciphertextExt - the extension of encrypted files
+const ciphertextExt = ".vault"
+
+// encrypt - encrypts plaintext with a transit key
+func (r Resource) encrypt(t models.Transit, plaintext []byte) (string, error) {
+	s, err := r.logical.Write(
+		fmt.Sprintf("%s/encrypt/%s", strings.Trim(t.Mount, "/"), t.Key),
+		map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if s == nil || s.Data == nil {
+		return "", errors.New("no ciphertext returned")
+	}
+
+	ciphertext, ok := s.Data["ciphertext"].(string)
+	if !ok {
+		return "", errors.New("no ciphertext returned")
+	}
+
+	return ciphertext, nil
+}
+
+// decrypt - decrypts transit ciphertext
+func (r Resource) decrypt(t models.Transit, ciphertext string) ([]byte, error) {
+	s, err := r.logical.Write(
+		fmt.Sprintf("%s/decrypt/%s", strings.Trim(t.Mount, "/"), t.Key),
+		map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if s == nil || s.Data == nil {
+		return nil, errors.New("no plaintext returned")
+	}
+
+	plaintext, ok := s.Data["plaintext"].(string)
+	if !ok {
+		return nil, errors.New("no plaintext returned")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	r.redactor.Add(plaintext, string(b))
+
+	return b, nil
+}
+
+// decryptSecrets - decrypts any transit ciphertext values in the secrets
+func (r *Resource) decryptSecrets() error {
+	if len(r.config.Source.TransitDecrypt.Key) <= 0 {
+		return nil
+	}
+
+	for k, v := range r.secrets {
+		d, err := r.decryptValue(v)
+		if err != nil {
+			return fmt.Errorf("error decrypting %s: %v", k, err)
+		}
+		r.secrets[k] = d
+	}
+
+	return nil
+}
+
+// decryptValue - recursively decrypts transit ciphertext in nested values
+func (r Resource) decryptValue(value interface{}) (interface{}, error) {
+	switch t := value.(type) {
+	case string:
+		if !strings.HasPrefix(t, ciphertextPrefix) {
+			return t, nil
+		}
+		b, err := r.decrypt(r.config.Source.TransitDecrypt, t)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+
+	case map[string]interface{}:
+		for k, v := range t {
+			d, err := r.decryptValue(v)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = d
+		}
+
+	case []interface{}:
+		for i, v := range t {
+			d, err := r.decryptValue(v)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = d
+		}
+	}
+
+	return value, nil
+}
+
+// transitFiles - encrypts or decrypts the files matching the transit params,
+// writing encrypted files with a .vault extension and decrypted files without
+func (r *Resource) transitFiles() (models.Metadata, error) {
+	t := r.config.Params.Transit
+
+	var files []string
+	for _, pattern := range t.Files {
+		p, err := r.workPath(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transit.files pattern: %v", err)
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transit.files pattern %s: %v", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+
+	if len(files) <= 0 {
+		return nil, errors.New("no files matched transit.files")
+	}
+	sort.Strings(files)
+
+	r.access(fmt.Sprintf("%s/%s/%s", strings.Trim(t.Mount, "/"), t.Action, t.Key), "")
+
+	var metadata models.Metadata
+	for _, f := range files {
+		src, err := filepath.Rel(r.workDir, f)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", src, err)
+		}
+
+		var (
+			dest string
+			out  []byte
+		)
+		switch t.Action {
+		case "encrypt":
+			ciphertext, err := r.encrypt(t.Transit, b)
+			if err != nil {
+				return nil, fmt.Errorf("error encrypting %s: %v", src, err)
+			}
+			dest = filepath.Base(src) + ciphertextExt
+			out = []byte(ciphertext)
+
+		case "decrypt":
+			out, err = r.decrypt(t.Transit, strings.TrimSpace(string(b)))
+			if err != nil {
+				return nil, fmt.Errorf("error decrypting %s: %v", src, err)
+			}
+			dest = strings.TrimSuffix(filepath.Base(src), ciphertextExt)
+		}
+
+		dir := filepath.Dir(src)
+		if len(t.Destination) > 0 {
+			dir = t.Destination
+		}
+		dest = filepath.Join(dir, dest)
+
+		destDir, err := r.workPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transit.destination: %v", err)
+		}
+
+		if err := os.MkdirAll(destDir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating %s: %v", dir, err)
+		}
+
+		if err := r.writeFile(dest, out, r.fileMode()); err != nil {
+			return nil, err
+		}
+
+		r.logger.Debug().Str("file", src).Str("destination", dest).
+			Msgf("%sed file", t.Action)
+		metadata = append(metadata, models.MetadataKvP{
+			Key:   src,
+			Value: dest,
+		})
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,57 @@
+package resource
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// unixScheme - the scheme of vault addresses which are unix sockets, such as
+// a vault agent listener
+const unixScheme = "unix://"
+
+// isUnix - whether a vault address is a unix socket
+func isUnix(addr string) bool {
+	return strings.HasPrefix(addr, unixScheme)
+}
+
+// newTransport - returns the transport used to connect to vault. requests are
+// proxied according to proxy_url and no_proxy, falling back to the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables. unix sockets
+// are never proxied
+func newTransport(source models.Source) *http.Transport {
+	t := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: source.VaultInsecure,
+		},
+		Proxy: http.ProxyFromEnvironment,
+	}
+
+	if isUnix(source.VaultAddr) {
+		t.Proxy = nil
+		return t
+	}
+
+	if len(source.ProxyURL) > 0 || len(source.NoProxy) > 0 {
+		config := httpproxy.FromEnvironment()
+		if len(source.ProxyURL) > 0 {
+			config.HTTPProxy = source.ProxyURL
+			config.HTTPSProxy = source.ProxyURL
+		}
+		if len(source.NoProxy) > 0 {
+			config.NoProxy = source.NoProxy
+		}
+
+		proxy := config.ProxyFunc()
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+
+	return t
+}
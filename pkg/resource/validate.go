@@ -2,14 +2,35 @@ package resource
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
 )
 
 // validate - validates the resource configuration
 func validate(config models.Request) (models.Request, error) {
+	if len(config.Source.VaultAddrs) > 0 {
+		// an agent listener is a single local address, there is nothing to
+		// fail over to
+		if isUnix(config.Source.VaultAddr) {
+			return config, errors.New("a unix socket vault_addr cannot be combined with vault_addrs")
+		}
+
+		if config.Source.Agent {
+			return config, errors.New("agent cannot be combined with vault_addrs, use vault_addr")
+		}
+	}
+
+	if len(config.Source.VaultAddr) <= 0 && len(config.Source.VaultAddrs) > 0 {
+		config.Source.VaultAddr = config.Source.VaultAddrs[0]
+	}
+
 	if len(config.Source.VaultAddr) <= 0 {
 		config.Source.VaultAddr = os.Getenv("VAULT_ADDR")
 		if len(config.Source.VaultAddr) <= 0 {
@@ -17,24 +38,184 @@ func validate(config models.Request) (models.Request, error) {
 		}
 	}
 
-	if len(config.Source.VaultPaths) <= 0 {
-		return config, errors.New("required argument vault_paths was not provided")
+	if len(config.Source.Mode) <= 0 {
+		config.Source.Mode = modeKV
+	}
+
+	switch config.Source.Mode {
+	case modeKV:
+		if len(config.Source.VaultPaths) <= 0 && !putAction(config.Params) {
+			return config, errors.New("required argument vault_paths was not provided")
+		}
+
+	case modePKI:
+		var err error
+		config.Source.PKI, err = validatePKI(config.Source.PKI)
+		if err != nil {
+			return config, err
+		}
+
+	case modeSSH:
+		// validated below, as put steps sign keys in any mode
+
+	default:
+		return config, errors.New("mode provided is not supported. supported modes are : \"kv\", \"pki\" or \"ssh\"")
+	}
+
+	if config.Source.Mode == modeSSH || len(config.Params.SSH.PublicKey) > 0 {
+		var err error
+		config.Source.SSH, err = validateSSH(config.Source.SSH)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	if len(config.Source.TransitDecrypt.Key) > 0 && len(config.Source.TransitDecrypt.Mount) <= 0 {
+		config.Source.TransitDecrypt.Mount = "transit"
+	}
+
+	if len(config.Params.Transit.Action) > 0 {
+		var err error
+		config.Params.Transit, err = validateTransit(config.Params.Transit)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	if len(config.Params.Action) > 0 {
+		if err := validateAction(config.Params); err != nil {
+			return config, err
+		}
+	} else if len(config.Params.RollbackTo) > 0 {
+		if err := validateRollback(config.Params); err != nil {
+			return config, err
+		}
+	} else if len(config.Params.Path) > 0 {
+		var err error
+		config.Params, err = validateWrite(config.Params)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	switch config.Source.Audit.Sink {
+	case "", auditStderr:
+	case auditFile, auditVault:
+		if len(config.Source.Audit.Path) <= 0 {
+			return config, errors.New("required argument audit.path was not provided")
+		}
+
+		// the build directory is discarded with each step, so a relative
+		// file would only ever hold a single record
+		if config.Source.Audit.Sink == auditFile && !filepath.IsAbs(config.Source.Audit.Path) {
+			return config, errors.New("audit.path must be an absolute path for the file sink")
+		}
+	default:
+		return config, errors.New("audit.sink provided is not supported. supported sinks are : \"stderr\", \"file\" or \"vault\"")
 	}
 
 	if len(config.Source.Format) <= 0 {
 		config.Source.Format = "json"
 	}
 
+	if len(config.Source.SecretsFile) <= 0 {
+		config.Source.SecretsFile = "secrets"
+	}
+
+	if filepath.Base(config.Source.SecretsFile) != config.Source.SecretsFile ||
+		config.Source.SecretsFile == "." || config.Source.SecretsFile == ".." {
+		return config, errors.New("secrets_file must be a file name, not a path")
+	}
+
+	if len(config.Source.FileMode) <= 0 {
+		config.Source.FileMode = "0600"
+	}
+
+	if _, err := strconv.ParseUint(config.Source.FileMode, 8, 32); err != nil {
+		return config, errors.New("file_mode must be an octal file mode such as \"0600\"")
+	}
+
+	if len(config.Source.FlattenSeparator) <= 0 {
+		config.Source.FlattenSeparator = "_"
+	}
+
+	if config.Source.Concurrency <= 0 {
+		config.Source.Concurrency = 4
+	}
+
+	if config.Source.MaxPaths <= 0 {
+		config.Source.MaxPaths = 100
+	}
+
+	if config.Source.MaxVersions <= 0 {
+		config.Source.MaxVersions = 10
+	}
+
 	if config.Source.Retries <= 0 {
 		config.Source.Retries = 3
 	}
 
+	if len(config.Source.RequestTimeout) <= 0 {
+		config.Source.RequestTimeout = "60s"
+	}
+
+	if len(config.Source.MinBackoff) <= 0 {
+		config.Source.MinBackoff = "1s"
+	}
+
+	if len(config.Source.MaxBackoff) <= 0 {
+		config.Source.MaxBackoff = "10s"
+	}
+
+	if len(config.Source.RetryableStatuses) <= 0 {
+		config.Source.RetryableStatuses = []int{429, 500, 502, 503, 504}
+	}
+
+	if len(config.Source.ChildTokenTTL) <= 0 {
+		config.Source.ChildTokenTTL = "1h"
+	}
+
+	for _, d := range []struct {
+		name  string
+		value string
+	}{
+		{"request_timeout", config.Source.RequestTimeout},
+		{"min_backoff", config.Source.MinBackoff},
+		{"max_backoff", config.Source.MaxBackoff},
+		{"timeout", config.Source.Timeout},
+		{"child_token_ttl", config.Source.ChildTokenTTL},
+	} {
+		if len(d.value) <= 0 {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return config, fmt.Errorf("%s must be a duration such as \"30s\"", d.name)
+		}
+	}
+
+	if duration(config.Source.MinBackoff) > duration(config.Source.MaxBackoff) {
+		return config, errors.New("min_backoff must not be longer than max_backoff")
+	}
+
 	if !strings.Contains(config.Source.Format, "json") &&
 		!strings.Contains(config.Source.Format, "yaml") {
 		return config, errors.New("format provided is not supported. supported output formats are : \"json\" or \"yaml\"")
 	}
 
-	if len(config.Source.VaultToken) <= 0 && len(config.Source.SecretID) <= 0 {
+	for _, addr := range config.Source.VaultAddrs {
+		if isUnix(addr) {
+			return config, errors.New("unix socket addresses are not supported in vault_addrs, use vault_addr")
+		}
+	}
+
+	if len(config.Source.ProxyURL) > 0 {
+		if _, err := url.Parse(config.Source.ProxyURL); err != nil {
+			return config, fmt.Errorf("proxy_url is not a valid url: %v", err)
+		}
+	}
+
+	if len(config.Source.VaultToken) <= 0 && len(config.Source.SecretID) <= 0 &&
+		!config.Source.Agent {
 		config.Source.VaultToken = os.Getenv("VAULT_TOKEN")
 		if len(config.Source.VaultToken) <= 0 {
 			return config, errors.New("vault_token was not provided")
@@ -43,3 +224,255 @@ func validate(config models.Request) (models.Request, error) {
 
 	return config, nil
 }
+
+// duration - parses a validated duration
+func duration(s string) time.Duration {
+	d, _ := time.ParseDuration(s)
+	return d
+}
+
+// validatePKI - validates the pki mode configuration
+func validatePKI(pki models.PKI) (models.PKI, error) {
+	if len(pki.Mount) <= 0 {
+		pki.Mount = "pki"
+	}
+
+	if len(pki.Role) <= 0 {
+		return pki, errors.New("required argument pki.role was not provided")
+	}
+
+	if len(pki.CommonName) <= 0 {
+		return pki, errors.New("required argument pki.common_name was not provided")
+	}
+
+	ttl, err := time.ParseDuration(pki.TTL)
+	if err != nil || ttl <= 0 {
+		return pki, errors.New("pki.ttl must be a duration such as \"720h\"")
+	}
+
+	if len(pki.RenewBefore) <= 0 {
+		pki.RenewBefore = (ttl / 3).String()
+	}
+
+	renewBefore, err := time.ParseDuration(pki.RenewBefore)
+	if err != nil || renewBefore < 0 || renewBefore >= ttl {
+		return pki, errors.New("pki.renew_before must be a duration shorter than pki.ttl")
+	}
+
+	return pki, nil
+}
+
+// validateSSH - validates the ssh configuration
+func validateSSH(ssh models.SSH) (models.SSH, error) {
+	if len(ssh.Mount) <= 0 {
+		ssh.Mount = "ssh"
+	}
+
+	if len(ssh.CertType) <= 0 {
+		ssh.CertType = "user"
+	}
+
+	if ssh.CertType != "user" && ssh.CertType != "host" {
+		return ssh, errors.New("ssh.cert_type provided is not supported. supported types are : \"user\" or \"host\"")
+	}
+
+	if len(ssh.Role) <= 0 {
+		return ssh, errors.New("required argument ssh.role was not provided")
+	}
+
+	ttl, err := time.ParseDuration(ssh.TTL)
+	if err != nil || ttl <= 0 {
+		return ssh, errors.New("ssh.ttl must be a duration such as \"1h\"")
+	}
+
+	if len(ssh.RenewBefore) <= 0 {
+		ssh.RenewBefore = (ttl / 3).String()
+	}
+
+	renewBefore, err := time.ParseDuration(ssh.RenewBefore)
+	if err != nil || renewBefore < 0 || renewBefore >= ttl {
+		return ssh, errors.New("ssh.renew_before must be a duration shorter than ssh.ttl")
+	}
+
+	return ssh, nil
+}
+
+// validateTransit - validates the transit put params
+func validateTransit(transit models.TransitParams) (models.TransitParams, error) {
+	if len(transit.Mount) <= 0 {
+		transit.Mount = "transit"
+	}
+
+	if transit.Action != "encrypt" && transit.Action != "decrypt" {
+		return transit, errors.New("transit.action provided is not supported. supported actions are : \"encrypt\" or \"decrypt\"")
+	}
+
+	if len(transit.Key) <= 0 {
+		return transit, errors.New("required argument transit.key was not provided")
+	}
+
+	if len(transit.Files) <= 0 {
+		return transit, errors.New("required argument transit.files was not provided")
+	}
+
+	return transit, nil
+}
+
+// validateWrite - validates the params of a kv write
+func validateWrite(p models.Params) (models.Params, error) {
+	if len(p.Data) <= 0 && len(p.DataFile) <= 0 && len(p.Generate.Key) <= 0 {
+		return p, errors.New("required argument data, data_file or generate was not provided")
+	}
+
+	if len(p.Data) > 0 && len(p.DataFile) > 0 {
+		return p, errors.New("only one of data or data_file may be provided")
+	}
+
+	if err := validateCAS(p); err != nil {
+		return p, err
+	}
+
+	if len(p.Method) <= 0 {
+		p.Method = methodWrite
+	}
+
+	if p.Method != methodWrite && p.Method != methodPatch {
+		return p, errors.New("method provided is not supported. supported methods are : \"write\" or \"patch\"")
+	}
+
+	if len(p.Generate.Key) > 0 {
+		var err error
+		p.Generate, err = validateGenerate(p.Generate)
+		if err != nil {
+			return p, err
+		}
+
+		if _, ok := p.Data[p.Generate.Key]; ok {
+			return p, fmt.Errorf("generate.key %s is also set in data", p.Generate.Key)
+		}
+	}
+
+	return p, nil
+}
+
+// validateGenerate - validates the params of a generated value, defaulting
+// those of the resource's own generator
+func validateGenerate(g models.Generate) (models.Generate, error) {
+	if len(g.Policy) > 0 {
+		if g.Length != 0 || len(g.Charset) > 0 || g.MinLowercase != 0 ||
+			g.MinUppercase != 0 || g.MinDigits != 0 || g.MinSymbols != 0 {
+			return g, errors.New("generate.policy may not be combined with length, charset or minimums")
+		}
+		return g, nil
+	}
+
+	if g.Length == 0 {
+		g.Length = 32
+	}
+
+	if len(g.Charset) <= 0 {
+		g.Charset = lowercase + uppercase + digits
+		if g.MinSymbols > 0 {
+			g.Charset += symbols
+		}
+	}
+
+	if g.Length < 0 || g.MinLowercase < 0 || g.MinUppercase < 0 ||
+		g.MinDigits < 0 || g.MinSymbols < 0 {
+		return g, errors.New("generate.length and minimums may not be negative")
+	}
+
+	required := 0
+	for _, c := range classes(g) {
+		if c.min > 0 && len(c.chars) <= 0 {
+			return g, fmt.Errorf("generate.%s is set but generate.charset has no such characters", c.name)
+		}
+		required += c.min
+	}
+
+	if required > g.Length {
+		return g, fmt.Errorf("generate minimums add up to %d, more than generate.length %d", required, g.Length)
+	}
+
+	return g, nil
+}
+
+// validateRollback - validates the params of a rollback of a kv2 secret
+func validateRollback(p models.Params) error {
+	if len(p.Path) <= 0 {
+		return errors.New("required argument path was not provided")
+	}
+
+	if to := string(p.RollbackTo); to != rollbackPrevious {
+		if n, err := strconv.Atoi(to); err != nil || n <= 0 {
+			return errors.New("rollback_to must be a version or previous")
+		}
+	}
+
+	if len(p.Data) > 0 || len(p.DataFile) > 0 || len(p.Generate.Key) > 0 || len(p.Method) > 0 {
+		return errors.New("rollback_to may not be combined with data, data_file, generate or method")
+	}
+
+	return validateCAS(p)
+}
+
+// validateCAS - validates the check-and-set version of a kv2 write
+func validateCAS(p models.Params) error {
+	switch cas := string(p.CAS); {
+	case len(cas) <= 0:
+	case cas == casFromInput:
+		if len(p.VersionsFrom) <= 0 {
+			return errors.New("required argument versions_from was not provided for cas from_input")
+		}
+	default:
+		if n, err := strconv.Atoi(cas); err != nil || n < 0 {
+			return errors.New("cas must be a version, 0 or from_input")
+		}
+	}
+
+	return nil
+}
+
+// validateAction - validates the params of an action removing a kv secret or
+// restoring its versions
+func validateAction(p models.Params) error {
+	if len(p.Path) <= 0 {
+		return errors.New("required argument path was not provided")
+	}
+
+	switch p.Action {
+	case actionDelete:
+	case actionUndelete, actionDestroy:
+		if len(p.Versions) <= 0 {
+			return fmt.Errorf("required argument versions was not provided for %s", p.Action)
+		}
+	case actionDeleteMetadata:
+		if len(p.Versions) > 0 {
+			return errors.New("versions cannot be provided for delete_metadata, which removes every version")
+		}
+	default:
+		return errors.New("action provided is not supported. supported actions are : \"delete\", \"undelete\", \"destroy\" or \"delete_metadata\"")
+	}
+
+	for _, v := range p.Versions {
+		if v <= 0 {
+			return errors.New("versions must be greater than 0")
+		}
+	}
+
+	if !p.Confirm && !p.DryRun {
+		return fmt.Errorf("confirm must be set to true to %s %s", strings.Replace(p.Action, "_", " ", -1), p.Path)
+	}
+
+	return nil
+}
+
+// putAction - whether the params request an action which does not read
+// vault_paths
+func putAction(p models.Params) bool {
+	return len(p.Path) > 0 ||
+		len(p.RenewLeasesFrom) > 0 ||
+		len(p.RevokeLeasesFrom) > 0 ||
+		len(p.SSH.PublicKey) > 0 ||
+		len(p.Transit.Action) > 0
+}
@@ -1,13 +1,15 @@
 package resource
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/rs/zerolog"
@@ -16,21 +18,53 @@ import (
 	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
 )
 
+// the files written alongside the secrets file
+const (
+	// leasesFile - the file the leases of dynamic secrets are written to
+	leasesFile = "leases"
+
+	// metadataFile - the file the check_metadata keys of secrets are
+	// written to
+	metadataFile = "metadata"
+
+	// versionsFile - the file the versions of kv2 secrets read are written
+	// to, so a put can check-and-set against them
+	versionsFile = "versions"
+)
+
+// the supported modes of the resource
+const (
+	modeKV  = "kv"
+	modePKI = "pki"
+	modeSSH = "ssh"
+)
+
+//go:generate counterfeiter -o ../../test/fakes/fake_vault.go . Vault
+
 // Vault - the vault resource interface
 type Vault interface {
 	Check() []models.Version
-	In() error
+	In() (models.Metadata, error)
+	Out() (models.Response, error)
 }
 
 // Resource - the vault resource
 type Resource struct {
-	client   *api.Client
-	logger   zerolog.Logger
-	config   models.Request
-	secrets  map[string]interface{}
-	workDir  string
-	roleID   string
-	secretID string
+	client     *api.Client
+	logical    Logical
+	cancel     context.CancelFunc
+	logger     zerolog.Logger
+	redactor   *Redactor
+	config     models.Request
+	secrets    map[string]interface{}
+	custom     map[string]map[string]string
+	versions   map[string]int
+	leases     []models.Lease
+	accessed   []models.Version
+	workDir    string
+	roleID     string
+	secretID   string
+	childToken bool
 }
 
 // New - returns a vault client for interaction with the vault API
@@ -38,9 +72,23 @@ func New(
 	workDir string,
 	config models.Request,
 	logger zerolog.Logger,
+	opts ...Option,
 ) (*Resource, error) {
 	var err error
 
+	r := &Resource{
+		workDir: workDir,
+		secrets: make(map[string]interface{}, 0),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.redactor == nil {
+		r.redactor = NewRedactor(os.Stderr)
+		logger = logger.Output(r.redactor)
+	}
+
 	if config.Source.Debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 		logger = logger.With().Caller().Logger()
@@ -51,18 +99,17 @@ func New(
 		logger.Fatal().Err(err).
 			Msg("error validating resource configuration")
 	}
+	r.redactor.Add(config.Source.VaultToken, config.Source.SecretID)
 
+	// retries and timeouts are applied by the logical client so that
+	// retryable statuses, backoff and the step deadline can be configured
 	c, err := api.NewClient(
 		&api.Config{
 			Address: config.Source.VaultAddr,
 			HttpClient: &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: config.Source.VaultInsecure,
-					},
-				},
+				Transport: newTransport(config.Source),
 			},
-			MaxRetries: config.Source.Retries,
+			MaxRetries: 0,
 		},
 	)
 	if err != nil {
@@ -74,12 +121,50 @@ func New(
 		c.SetToken(config.Source.VaultToken)
 	}
 
-	r := &Resource{
-		client:  c,
-		config:  config,
-		logger:  logger,
-		workDir: workDir,
-		secrets: make(map[string]interface{}, 0),
+	// build metadata lets vault audit logs trace requests back to the build
+	if h := buildFromEnv().headers(); len(h) > 0 {
+		c.SetHeaders(h)
+	}
+
+	// the step deadline bounds every request, including retries
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if len(config.Source.Timeout) > 0 {
+		ctx, cancel = context.WithTimeout(ctx, duration(config.Source.Timeout))
+	}
+
+	retryable := make(map[int]bool, 0)
+	for _, status := range config.Source.RetryableStatuses {
+		retryable[status] = true
+	}
+
+	// an injected Logical makes every request, so the client is never
+	// pointed at a vault address
+	injected := r.logical != nil
+
+	r.client = c
+	l := &logical{
+		client:         c,
+		ctx:            ctx,
+		logger:         logger,
+		retries:        config.Source.Retries,
+		requestTimeout: duration(config.Source.RequestTimeout),
+		minBackoff:     duration(config.Source.MinBackoff),
+		maxBackoff:     duration(config.Source.MaxBackoff),
+		retryable:      retryable,
+	}
+	if r.logical == nil {
+		r.logical = l
+	}
+	r.cancel = cancel
+	r.config = config
+	r.logger = logger
+
+	if !injected {
+		err = r.selectAddr(l)
+		if err != nil {
+			r.logger.Fatal().Err(err).
+				Msg("error selecting vault address")
+		}
 	}
 
 	err = r.setToken()
@@ -93,56 +178,186 @@ func New(
 
 // Check - checks vault for new secret version
 func (r Resource) Check() []models.Version {
+	defer r.cancel()
+
 	err := r.renewToken()
 	if err != nil {
 		r.logger.Fatal().AnErr("err", err).
 			Msg("error occured renewing token")
 	}
 
+	switch r.config.Source.Mode {
+	case modePKI:
+		return r.checkPKI()
+	case modeSSH:
+		return r.checkSSH()
+	}
+
+	paths, patterns, err := r.expandPaths()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error expanding paths")
+	}
+
+	names := sortedPaths(paths)
+	results := make([][]models.Version, len(names))
+	err = parallel(len(names), r.config.Source.Concurrency, func(i int) error {
+		v, err := r.checkPath(names[i], paths[names[i]])
+		if err != nil {
+			return fmt.Errorf("error checking %s: %v", names[i], err)
+		}
+		results[i] = v
+		return nil
+	})
+	if err != nil {
+		r.logger.Fatal().AnErr("err", err).
+			Msg("error occured reading paths")
+	}
+
 	var versions []models.Version
-	for p, ver := range r.config.Source.VaultPaths {
-		if ver > 0 || ver == -1 {
-			s, err := r.client.Logical().Read(
-				strings.Replace(p, "data", "metadata", 1),
-			)
-			if err != nil {
-				r.logger.Fatal().AnErr("err", err).
-					Msg("error occured reading paths")
-			}
+	for _, v := range results {
+		versions = append(versions, v...)
+	}
 
-			if s != nil {
-				versions = append(versions, models.Version{
-					Path: p,
-					Version: fmt.Sprintf(
-						"%v", s.Data["current_version"],
-					),
-				})
-			}
-		} else {
-			versions = append(versions, models.Version{
+	// secrets added or removed under a pattern change the pattern's version
+	for _, p := range sortedPatterns(patterns) {
+		versions = append(versions, models.Version{
+			Path:    p,
+			Version: matchesVersion(patterns[p]),
+		})
+	}
+
+	return versions
+}
+
+// checkPath - checks a single path for its versions
+func (r Resource) checkPath(p string, ver int) ([]models.Version, error) {
+	// reading a dynamic secret issues new credentials, so they are never
+	// read during a check
+	m, err := r.mountInfo(p)
+	if err != nil {
+		r.logger.Debug().Err(err).Str("path", p).
+			Msg("could not determine mount, assuming kv")
+	} else if m.dynamic() {
+		return []models.Version{{
+			Path:    p,
+			Version: "1",
+		}}, nil
+	}
+
+	if ver > 0 || ver == -1 {
+		if m == nil {
+			return nil, fmt.Errorf("error looking up the mount of %s: %v", p, err)
+		}
+
+		// only kv2 secrets have versions
+		if m.KVVersion != 2 {
+			return []models.Version{{
 				Path:    p,
 				Version: "1",
-			})
+			}}, nil
+		}
+
+		s, err := r.logical.Read(kv2Path(m, p, "metadata"))
+		if err != nil {
+			return nil, err
+		}
+
+		if s == nil {
+			return nil, nil
+		}
+
+		// deleted and destroyed versions cannot be read, so only readable
+		// versions are reported
+		if versions := kv2Versions(s); len(versions) > 0 {
+			history := r.history(p, versions, r.metadataSuffix(s))
+			if len(history) <= 0 {
+				r.logger.Warn().Str("path", p).
+					Msg("every version is deleted or destroyed")
+			}
+			return history, nil
 		}
+
+		return []models.Version{{
+			Path: p,
+			Version: fmt.Sprintf(
+				"%v", s.Data["current_version"],
+			),
+		}}, nil
 	}
 
-	return versions
+	return []models.Version{{
+		Path:    p,
+		Version: "1",
+	}}, nil
 }
 
 // In - executes the resource
-func (r *Resource) In() error {
+func (r *Resource) In() (models.Metadata, error) {
+	defer r.cancel()
+	defer r.revokeChildToken()
+
 	err := r.renewToken()
 	if err != nil {
 		r.logger.Fatal().AnErr("err", err).
 			Msg("error occured renewing token")
 	}
 
+	if r.config.Source.ChildToken && r.readsLeases() {
+		r.logger.Debug().Msg("not creating a child token, as leases would be revoked with it")
+	} else if err := r.createChildToken(); err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error creating child token")
+	}
+
+	switch r.config.Source.Mode {
+	case modePKI:
+		metadata, err := r.issueCertificate()
+		if err != nil {
+			r.logger.Fatal().Err(err).
+				Msg("error issuing certificate")
+		}
+
+		err = r.audit("in")
+		if err != nil {
+			r.logger.Fatal().Err(err).
+				Msg("error recording access")
+		}
+		return append(metadata, r.addrMetadata()), nil
+
+	case modeSSH:
+		metadata, err := r.signKeyPair()
+		if err != nil {
+			r.logger.Fatal().Err(err).
+				Msg("error signing ssh key")
+		}
+
+		err = r.audit("in")
+		if err != nil {
+			r.logger.Fatal().Err(err).
+				Msg("error recording access")
+		}
+		return append(metadata, r.addrMetadata()), nil
+	}
+
 	err = r.read()
 	if err != nil {
 		r.logger.Fatal().Err(err).
 			Msg("error reading secrets")
 	}
 
+	err = r.decryptSecrets()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error decrypting secrets")
+	}
+
+	err = r.flatten()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error flattening secrets")
+	}
+
 	r.prefix()
 
 	r.sanitize()
@@ -155,41 +370,214 @@ func (r *Resource) In() error {
 			Msg("error formatting secrets")
 	}
 
-	return nil
+	err = r.writeLeases()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error writing leases")
+	}
+
+	err = r.writeMetadata()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error writing metadata")
+	}
+
+	err = r.writeVersions()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error writing versions")
+	}
+
+	err = r.audit("in")
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error recording access")
+	}
+
+	metadata := models.Metadata{r.addrMetadata()}
+	for _, l := range r.leases {
+		metadata = append(metadata, models.MetadataKvP{
+			Key: l.Path,
+			Value: fmt.Sprintf(
+				"lease_id=%s ttl=%ds renewable=%t",
+				l.LeaseID, l.LeaseDuration, l.Renewable,
+			),
+		})
+	}
+
+	return metadata, nil
 }
 
-// format - formats the output in either json or yaml
-func (r Resource) format() error {
-	var (
-		b   []byte
-		err error
-	)
+// flatten - flattens nested maps and lists into top level keys
+func (r *Resource) flatten() error {
+	if !r.config.Source.Flatten {
+		return nil
+	}
 
-	switch f := strings.ToLower(r.config.Source.Format); f {
-	case "json":
-		b, err = json.Marshal(r.secrets)
+	s := make(map[string]interface{}, 0)
+	for k, v := range r.secrets {
+		err := flattenValue(s, k, v, r.config.Source.FlattenSeparator)
 		if err != nil {
 			return err
 		}
+	}
+	r.secrets = s
+
+	return nil
+}
+
+// flattenValue - recursively writes a value into dst, joining nested keys and
+// list indices to key with sep. a key written twice, such as db_host from both
+// db_host and {"db": {"host": ...}}, is an error
+func flattenValue(dst map[string]interface{}, key string, value interface{}, sep string) error {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		if len(t) > 0 {
+			for k, v := range t {
+				err := flattenValue(dst, fmt.Sprintf("%s%s%s", key, sep, k), v, sep)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			for i, v := range t {
+				err := flattenValue(dst, fmt.Sprintf("%s%s%d", key, sep, i), v, sep)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	if _, ok := dst[key]; ok {
+		return fmt.Errorf("flattened key %s collides with another key", key)
+	}
+	dst[key] = value
+
+	return nil
+}
+
+// Out - executes a put of the resource
+func (r *Resource) Out() (models.Response, error) {
+	defer r.cancel()
+	defer r.revokeChildToken()
+
+	response := models.Response{
+		Version: models.Version{
+			Version: fmt.Sprintf("%d", time.Now().UTC().Unix()),
+		},
+	}
+
+	if !putAction(r.config.Params) {
+		return response, errors.New("no put action provided in params")
+	}
+
+	err := r.renewToken()
+	if err != nil {
+		r.logger.Fatal().AnErr("err", err).
+			Msg("error occured renewing token")
+	}
+
+	err = r.createChildToken()
+	if err != nil {
+		r.logger.Fatal().Err(err).
+			Msg("error creating child token")
+	}
 
-	case "yaml":
-		b, err = yaml.Marshal(r.secrets)
+	if len(r.config.Params.Action) > 0 {
+		v, m, err := r.removeSecret()
+		response.Version = v
+		response.Metadata = append(response.Metadata, m...)
 		if err != nil {
-			return err
+			return response, err
 		}
+	} else if len(r.config.Params.RollbackTo) > 0 {
+		v, m, err := r.rollbackSecret()
+		response.Version = v
+		response.Metadata = append(response.Metadata, m...)
+		if err != nil {
+			return response, err
+		}
+	} else if len(r.config.Params.Path) > 0 {
+		v, m, err := r.writeSecret()
+		response.Version = v
+		response.Metadata = append(response.Metadata, m...)
+		if err != nil {
+			return response, err
+		}
+	}
 
-	default:
-		b, err = json.Marshal(r.secrets)
+	if len(r.config.Params.RenewLeasesFrom) > 0 {
+		response.Version.Path = "sys/leases/renew"
+		m, err := r.renewLeases(r.config.Params.RenewLeasesFrom)
+		response.Metadata = append(response.Metadata, m...)
 		if err != nil {
-			return err
+			return response, err
+		}
+	}
+
+	if len(r.config.Params.RevokeLeasesFrom) > 0 {
+		response.Version.Path = "sys/leases/revoke"
+		m, err := r.revokeLeases(r.config.Params.RevokeLeasesFrom)
+		response.Metadata = append(response.Metadata, m...)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	if len(r.config.Params.SSH.PublicKey) > 0 {
+		response.Version.Path = r.sshPath()
+		m, err := r.signPublicKey()
+		response.Metadata = append(response.Metadata, m...)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	if len(r.config.Params.Transit.Action) > 0 {
+		t := r.config.Params.Transit
+		response.Version.Path = fmt.Sprintf("%s/%s/%s", t.Mount, t.Action, t.Key)
+		m, err := r.transitFiles()
+		response.Metadata = append(response.Metadata, m...)
+		if err != nil {
+			return response, err
 		}
 	}
 
+	err = r.audit("out")
+	if err != nil {
+		return response, fmt.Errorf("error recording access: %v", err)
+	}
+
+	response.Metadata = append(response.Metadata, r.addrMetadata())
+
+	return response, nil
+}
+
+// addrMetadata - the address of the vault server requests were made to
+func (r Resource) addrMetadata() models.MetadataKvP {
+	return models.MetadataKvP{
+		Key:   "vault_addr",
+		Value: r.client.Address(),
+	}
+}
+
+// format - formats the output in either json or yaml
+func (r Resource) format() error {
+	b, err := r.marshal(r.secrets)
+	if err != nil {
+		return err
+	}
+
 	if len(b) <= 0 {
 		return errors.New("no secrets found to write to file")
 	}
 
-	err = r.write(b)
+	err = r.writeFile(r.config.Source.SecretsFile, b, r.fileMode())
 	if err != nil {
 		return err
 	}
@@ -197,6 +585,44 @@ func (r Resource) format() error {
 	return nil
 }
 
+// writeVersions - writes the versions of the kv2 secrets read to the versions
+// file when write_versions is set
+func (r Resource) writeVersions() error {
+	if !r.config.Params.WriteVersions || len(r.versions) <= 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(r.versions)
+	if err != nil {
+		return err
+	}
+
+	return r.writeFile(versionsFile, b, r.fileMode())
+}
+
+// marshal - marshals a value in the configured format
+func (r Resource) marshal(v interface{}) ([]byte, error) {
+	if strings.ToLower(r.config.Source.Format) == "yaml" {
+		return yaml.Marshal(v)
+	}
+	return json.Marshal(v)
+}
+
+// writeLeases - writes the leases of any dynamic secrets read to the leases
+// file so they may later be renewed or revoked
+func (r Resource) writeLeases() error {
+	if len(r.leases) <= 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(r.leases)
+	if err != nil {
+		return err
+	}
+
+	return r.writeFile(leasesFile, b, r.fileMode())
+}
+
 // prefix - adds a custom prefix to each key
 func (r *Resource) prefix() {
 	if len(r.config.Source.Prefix) <= 0 {
@@ -210,43 +636,93 @@ func (r *Resource) prefix() {
 	r.secrets = s
 }
 
-// read - reads vault for a secret at a given path
+// read - reads vault for a secret at a given path. paths are read
+// concurrently and merged in lexical order, so a key found at more than one
+// path always takes the value from the last path
 func (r *Resource) read() error {
-	var (
-		s      *api.Secret
-		err    error
-		result = make(map[string]interface{}, 0)
-	)
+	result := make(map[string]interface{}, 0)
 
-	for p, ver := range r.config.Source.VaultPaths {
-		if ver > 0 {
-			s, err = r.client.Logical().ReadWithData(p, map[string][]string{
-				"version": []string{fmt.Sprintf("%d", ver)},
-			})
-		} else {
-			s, err = r.client.Logical().Read(p)
+	paths, _, err := r.expandPaths()
+	if err != nil {
+		return err
+	}
+
+	names := sortedPaths(paths)
+	secrets := make([]*api.Secret, len(names))
+	customs := make([]map[string]string, len(names))
+	err = parallel(len(names), r.config.Source.Concurrency, func(i int) error {
+		s, err := r.readPath(names[i], r.requestedVersion(names[i], paths[names[i]]))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", names[i], err)
 		}
+
+		s, err = r.readable(names[i], s)
 		if err != nil {
-			r.logger.Fatal().AnErr("err", err).
-				Msg("error occured reading paths")
+			return fmt.Errorf("error reading %s: %v", names[i], err)
 		}
+		secrets[i] = s
 
-		if s != nil {
-			// KV2
-			if d, ok := s.Data["data"]; ok {
-				switch t := d.(type) {
-				case map[string]interface{}:
-					for k, v := range t {
-						result[k] = v
-					}
-				default:
-					r.logger.Debug().Msg("could not determine secret type")
-				}
-			} else {
-				// KV1
-				for k, v := range s.Data {
+		customs[i], err = r.readCustomMetadata(names[i], s)
+		if err != nil {
+			return fmt.Errorf("error reading metadata of %s: %v", names[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.custom = make(map[string]map[string]string, 0)
+	r.versions = make(map[string]int, 0)
+	for i, s := range secrets {
+		if customs[i] != nil {
+			r.custom[names[i]] = customs[i]
+		}
+
+		if s == nil {
+			continue
+		}
+
+		r.access(names[i], secretVersion(s, paths[names[i]]))
+
+		if _, ok := s.Data["metadata"].(map[string]interface{}); ok {
+			n, err := strconv.Atoi(secretVersion(s, paths[names[i]]))
+			if err == nil {
+				r.versions[names[i]] = n
+			}
+		}
+
+		// dynamic secrets are leased and never nested
+		if len(s.LeaseID) > 0 {
+			r.leases = append(r.leases, models.Lease{
+				Path:          names[i],
+				LeaseID:       s.LeaseID,
+				LeaseDuration: s.LeaseDuration,
+				Renewable:     s.Renewable,
+			})
+			r.redactor.AddValue(s.Data)
+			for k, v := range s.Data {
+				result[k] = v
+			}
+			continue
+		}
+
+		// KV2, whose metadata is not redacted
+		if d, ok := s.Data["data"]; ok {
+			r.redactor.AddValue(d)
+			switch t := d.(type) {
+			case map[string]interface{}:
+				for k, v := range t {
 					result[k] = v
 				}
+			default:
+				r.logger.Debug().Msg("could not determine secret type")
+			}
+		} else {
+			// KV1
+			r.redactor.AddValue(s.Data)
+			for k, v := range s.Data {
+				result[k] = v
 			}
 		}
 	}
@@ -265,6 +741,32 @@ func (r *Resource) read() error {
 	return nil
 }
 
+// secretVersion - the version of a secret that was read, if it has one
+func secretVersion(s *api.Secret, ver int) string {
+	if m, ok := s.Data["metadata"].(map[string]interface{}); ok {
+		if v, ok := m["version"]; ok {
+			return fmt.Sprintf("%v", v)
+		}
+	}
+
+	if ver > 0 {
+		return fmt.Sprintf("%d", ver)
+	}
+
+	return ""
+}
+
+// readPath - reads a secret at a path, at a specific version if ver is set
+func (r Resource) readPath(p string, ver int) (*api.Secret, error) {
+	if ver > 0 {
+		return r.logical.ReadWithData(p, map[string][]string{
+			"version": []string{fmt.Sprintf("%d", ver)},
+		})
+	}
+
+	return r.logical.Read(p)
+}
+
 // sanitize - sanitizes keys converting dashes(-) and dots(.) to underscores
 func (r *Resource) sanitize() {
 	if !r.config.Source.Sanitize {
@@ -292,23 +794,3 @@ func (r *Resource) upcase() {
 	}
 	r.secrets = s
 }
-
-// write - writes the secrets to a file
-func (r Resource) write(b []byte) error {
-	f, err := os.OpenFile(
-		fmt.Sprintf("%s/secrets", r.workDir),
-		os.O_CREATE|os.O_WRONLY, 0644,
-	)
-	if err != nil {
-		r.logger.Fatal().Err(err).
-			Msg("error opening file for write")
-	}
-	defer f.Close()
-
-	if _, err := f.Write(b); err != nil {
-		r.logger.Fatal().Err(err).
-			Msg("error writing to destination file")
-	}
-
-	return nil
-}
@@ -0,0 +1,296 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+)
+
+// kv2Version - a version of a kv2 secret as listed in its metadata
+type kv2Version struct {
+	Version      int
+	DeletionTime string
+	Destroyed    bool
+}
+
+// unreadable - why a version cannot be read, or an empty string if it can. a
+// deletion_time in the future is set by delete_version_after, and the
+// version remains readable until then
+func (v kv2Version) unreadable() string {
+	if v.Destroyed {
+		return "has been destroyed"
+	}
+
+	if len(v.DeletionTime) <= 0 {
+		return ""
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v.DeletionTime)
+	if err == nil && t.After(time.Now()) {
+		return ""
+	}
+
+	return fmt.Sprintf("was deleted at %s", v.DeletionTime)
+}
+
+// versionFromMetadata - the version described by the metadata of a kv2 read
+// or a version in the versions map of kv2 metadata
+func versionFromMetadata(m map[string]interface{}) kv2Version {
+	v := kv2Version{}
+	fmt.Sscanf(fmt.Sprintf("%v", m["version"]), "%d", &v.Version)
+	v.DeletionTime, _ = m["deletion_time"].(string)
+	v.Destroyed, _ = m["destroyed"].(bool)
+	return v
+}
+
+// kv2Versions - the versions listed in kv2 metadata, oldest first. metadata
+// without a versions map yields none
+func kv2Versions(s *api.Secret) []kv2Version {
+	if s == nil || s.Data == nil {
+		return nil
+	}
+
+	m, ok := s.Data["versions"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	versions := make([]kv2Version, 0, len(m))
+	for k, meta := range m {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+
+		v := kv2Version{}
+		if meta, ok := meta.(map[string]interface{}); ok {
+			v = versionFromMetadata(meta)
+		}
+		v.Version = n
+		versions = append(versions, v)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions
+}
+
+// newestReadable - the newest version which can be read, or 0 if none can
+func newestReadable(versions []kv2Version) int {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if len(versions[i].unreadable()) <= 0 {
+			return versions[i].Version
+		}
+	}
+	return 0
+}
+
+// versionNumber - the kv2 version of a version reported by check, or 0 if it
+// is not a number. the version may carry a digest of custom_metadata after a +
+func versionNumber(v string) int {
+	n, err := strconv.Atoi(strings.SplitN(v, "+", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// requestedVersion - the version of p to read. when concourse asks for a
+// version check reported for an unpinned p, that version is read rather than
+// the latest. a pinned version is always read
+func (r Resource) requestedVersion(p string, ver int) int {
+	if r.config.Version.Path != p || ver != -1 {
+		return ver
+	}
+
+	if n := versionNumber(r.config.Version.Version); n > 0 {
+		return n
+	}
+	return ver
+}
+
+// history - the readable versions of p from the version concourse last saw
+// up to the newest, oldest first, so that every rotation is seen. at most
+// max_versions are returned, keeping the newest. suffix is appended to each
+// version
+func (r Resource) history(p string, versions []kv2Version, suffix string) []models.Version {
+	newest := newestReadable(versions)
+	if newest <= 0 {
+		return nil
+	}
+
+	from := newest
+	if r.config.Version.Path == p {
+		n := versionNumber(r.config.Version.Version)
+		if n > 0 && n < newest {
+			from = n
+		}
+	}
+
+	var history []models.Version
+	for _, v := range versions {
+		if v.Version < from || v.Version > newest || len(v.unreadable()) > 0 {
+			continue
+		}
+
+		version := strconv.Itoa(v.Version) + suffix
+		// the version concourse last saw is reported as it was seen, so
+		// that it is not mistaken for a new version
+		if v.Version == from && from < newest {
+			version = r.config.Version.Version
+		}
+
+		history = append(history, models.Version{
+			Path:    p,
+			Version: version,
+		})
+	}
+
+	if len(history) > r.config.Source.MaxVersions {
+		history = history[len(history)-r.config.Source.MaxVersions:]
+	}
+
+	return history
+}
+
+// metadataPath - the metadata path of a secret on the kv2 mount serving p
+func (r Resource) metadataPath(p string) (string, error) {
+	m, err := r.mountInfo(p)
+	if err != nil {
+		return "", err
+	}
+
+	if m.KVVersion != 2 {
+		return "", fmt.Errorf("%s is not on a kv2 mount", p)
+	}
+
+	return kv2Path(m, p, "metadata"), nil
+}
+
+// readable - checks a kv2 secret read from p is readable. when it is not, it
+// is an error unless fallback_to_readable is set, in which case the newest
+// readable version is read instead
+func (r Resource) readable(p string, s *api.Secret) (*api.Secret, error) {
+	if s == nil || s.Data == nil {
+		return s, nil
+	}
+
+	meta, ok := s.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return s, nil
+	}
+
+	v := versionFromMetadata(meta)
+	reason := v.unreadable()
+	if len(reason) <= 0 {
+		return s, nil
+	}
+
+	if !r.config.Source.FallbackToReadable {
+		return nil, fmt.Errorf("version %d %s", v.Version, reason)
+	}
+
+	mp, err := r.metadataPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := r.logical.Read(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	ver := newestReadable(kv2Versions(m))
+	if ver <= 0 {
+		return nil, fmt.Errorf(
+			"version %d %s and no readable version remains",
+			v.Version, reason,
+		)
+	}
+
+	r.logger.Warn().Str("path", p).Int("version", v.Version).Int("fallback", ver).
+		Msgf("version %s, reading the newest readable version", reason)
+
+	return r.readPath(p, ver)
+}
+
+// customMetadata - the check_metadata keys of the custom_metadata in kv2
+// metadata
+func (r Resource) customMetadata(s *api.Secret) map[string]string {
+	custom := make(map[string]string, 0)
+	if s == nil || s.Data == nil {
+		return custom
+	}
+
+	m, _ := s.Data["custom_metadata"].(map[string]interface{})
+	for _, k := range r.config.Source.CheckMetadata {
+		if v, ok := m[k]; ok && v != nil {
+			custom[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return custom
+}
+
+// metadataSuffix - the suffix folded into the versions of a kv2 secret so
+// that a change to its check_metadata keys is a new version
+func (r Resource) metadataSuffix(s *api.Secret) string {
+	if len(r.config.Source.CheckMetadata) <= 0 {
+		return ""
+	}
+
+	custom := r.customMetadata(s)
+	pairs := make([]string, 0, len(custom))
+	for k, v := range custom {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+
+	return "+" + matchesVersion(pairs)
+}
+
+// readCustomMetadata - the check_metadata keys of the kv2 secret read from p
+func (r Resource) readCustomMetadata(p string, s *api.Secret) (map[string]string, error) {
+	if len(r.config.Source.CheckMetadata) <= 0 || s == nil {
+		return nil, nil
+	}
+
+	if _, ok := s.Data["metadata"].(map[string]interface{}); !ok {
+		return nil, nil
+	}
+
+	mp, err := r.metadataPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := r.logical.Read(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.customMetadata(m), nil
+}
+
+// writeMetadata - writes the check_metadata keys of the secrets read to the
+// metadata file, by the path they were read from
+func (r Resource) writeMetadata() error {
+	if len(r.config.Source.CheckMetadata) <= 0 {
+		return nil
+	}
+
+	b, err := r.marshal(r.custom)
+	if err != nil {
+		return err
+	}
+
+	return r.writeFile(metadataFile, b, r.fileMode())
+}
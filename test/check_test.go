@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"os/exec"
+	"strconv"
 	"time"
 
 	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
@@ -60,6 +61,310 @@ var _ = Describe("Check()", func() {
 			Expect(resp).NotTo(BeEmpty())
 		})
 
+		It("reports the current version of a kv2 secret", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+			var resp []models.Version
+			err := json.Unmarshal(session.Out.Contents(), &resp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(ConsistOf(models.Version{
+				Path:    "kv2/data/atu/foo",
+				Version: "2",
+			}))
+		})
+
+		Context("when the current version is deleted", func() {
+			BeforeEach(func() {
+				server.DeleteKV2Version("kv2/data/atu/foo", 2)
+			})
+
+			It("reports the newest readable version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(ConsistOf(models.Version{
+					Path:    "kv2/data/atu/foo",
+					Version: "1",
+				}))
+			})
+		})
+
+		Context("when concourse last saw an older version", func() {
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+					"password": "n3w3r-p4ssw0rd",
+				})
+				server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+					"password": "n3w3st-p4ssw0rd",
+				})
+				server.DeleteKV2Version("kv2/data/atu/foo", 3)
+
+				checkRequest.Version = models.Version{
+					Path:    "kv2/data/atu/foo",
+					Version: "1",
+				}
+				stdinContents, err = json.Marshal(checkRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports every readable version since, oldest first", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(Equal([]models.Version{
+					{Path: "kv2/data/atu/foo", Version: "1"},
+					{Path: "kv2/data/atu/foo", Version: "2"},
+					{Path: "kv2/data/atu/foo", Version: "4"},
+				}))
+			})
+
+			Context("and max_versions is set", func() {
+				BeforeEach(func() {
+					checkRequest.Source.MaxVersions = 2
+					stdinContents, err = json.Marshal(checkRequest)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+
+				It("reports only the newest versions", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+					var resp []models.Version
+					err := json.Unmarshal(session.Out.Contents(), &resp)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp).To(Equal([]models.Version{
+						{Path: "kv2/data/atu/foo", Version: "2"},
+						{Path: "kv2/data/atu/foo", Version: "4"},
+					}))
+				})
+			})
+		})
+
+		Context("when check_metadata is set", func() {
+			checkVersion := func() string {
+				session := run(exec.Command(checkPath), stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(HaveLen(1))
+
+				return resp[0].Version
+			}
+
+			BeforeEach(func() {
+				server.SetCustomMetadata("kv2/data/atu/foo", map[string]string{
+					"owner":      "atu",
+					"deprecated": "false",
+				})
+
+				checkRequest.Source.CheckMetadata = []string{"deprecated"}
+				stdinContents, err = json.Marshal(checkRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports a new version when a chosen key changes", func() {
+				By("Running the command")
+				version := checkVersion()
+				Expect(version).To(MatchRegexp(`^2\+[0-9a-f]{12}$`))
+
+				By("Changing a key which is not checked")
+				server.SetCustomMetadata("kv2/data/atu/foo", map[string]string{
+					"owner":      "someone-else",
+					"deprecated": "false",
+				})
+				Expect(checkVersion()).To(Equal(version))
+
+				By("Changing a checked key")
+				server.SetCustomMetadata("kv2/data/atu/foo", map[string]string{
+					"owner":      "someone-else",
+					"deprecated": "true",
+				})
+				Expect(checkVersion()).NotTo(Equal(version))
+			})
+		})
+
+		Context("when the name of the mount contains data", func() {
+			BeforeEach(func() {
+				server.WriteKV2("appdata/data/atu/foo", map[string]interface{}{
+					"password": "0ld-p4ssw0rd",
+				})
+				server.WriteKV2("appdata/data/atu/foo", map[string]interface{}{
+					"password": "n3w-p4ssw0rd",
+				})
+
+				checkRequest.Source.VaultPaths = map[string]int{
+					"appdata/data/atu/foo": 2,
+				}
+				stdinContents, err = json.Marshal(checkRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reads the metadata of the secret on that mount", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(ConsistOf(models.Version{
+					Path:    "appdata/data/atu/foo",
+					Version: "2",
+				}))
+			})
+		})
+
+		Context("when vault_paths contains a pattern", func() {
+			checkVersions := func() []models.Version {
+				session := run(exec.Command(checkPath), stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+
+				return resp
+			}
+
+			patternVersion := func(versions []models.Version) string {
+				for _, v := range versions {
+					if v.Path == "kv2/team/app/*" {
+						return v.Version
+					}
+				}
+				Fail("the pattern has no version")
+				return ""
+			}
+
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/team/app/web", map[string]interface{}{"key": "w3b-k3y"})
+				server.WriteKV2("kv2/data/team/app/worker", map[string]interface{}{"key": "w0rk3r-k3y"})
+				server.WriteKV2("kv2/data/team/app/nested/db", map[string]interface{}{"key": "d4t4b4s3"})
+				server.WriteKV2("kv2/data/team/other", map[string]interface{}{"key": "0th3r-k3y"})
+
+				checkRequest.Source.VaultPaths = map[string]int{
+					"kv2/team/app/*": 0,
+				}
+			})
+
+			JustBeforeEach(func() {
+				stdinContents, err = json.Marshal(checkRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reports the version of every secret the pattern matches", func() {
+				By("Running the command")
+				versions := checkVersions()
+
+				Expect(versions).To(ConsistOf(
+					models.Version{Path: "kv2/data/team/app/web", Version: "1"},
+					models.Version{Path: "kv2/data/team/app/worker", Version: "1"},
+					models.Version{Path: "kv2/team/app/*", Version: patternVersion(versions)},
+				))
+			})
+
+			It("reports a new version when a secret is added under the pattern", func() {
+				By("Running the command")
+				version := patternVersion(checkVersions())
+
+				By("Writing a secret the pattern does not match")
+				server.WriteKV2("kv2/data/team/app/nested/cache", map[string]interface{}{"key": "c4ch3-k3y"})
+				Expect(patternVersion(checkVersions())).To(Equal(version))
+
+				By("Writing a secret the pattern matches")
+				server.WriteKV2("kv2/data/team/app/api", map[string]interface{}{"key": "4p1-k3y"})
+				Expect(patternVersion(checkVersions())).NotTo(Equal(version))
+			})
+
+			Context("with **", func() {
+				BeforeEach(func() {
+					checkRequest.Source.VaultPaths = map[string]int{
+						"kv2/data/team/**": 0,
+					}
+				})
+
+				It("matches secrets at any depth", func() {
+					By("Running the command")
+					var paths []string
+					for _, v := range checkVersions() {
+						paths = append(paths, v.Path)
+					}
+
+					Expect(paths).To(ConsistOf(
+						"kv2/data/team/app/web",
+						"kv2/data/team/app/worker",
+						"kv2/data/team/app/nested/db",
+						"kv2/data/team/other",
+						"kv2/data/team/**",
+					))
+				})
+			})
+
+			Context("on a kv1 mount", func() {
+				BeforeEach(func() {
+					server.WriteKV1("secret/team/app/web", map[string]interface{}{"key": "w3b-k3y"})
+
+					checkRequest.Source.VaultPaths = map[string]int{
+						"secret/team/*/web": 0,
+					}
+				})
+
+				It("matches secrets on the mount", func() {
+					By("Running the command")
+					var paths []string
+					for _, v := range checkVersions() {
+						paths = append(paths, v.Path)
+					}
+
+					Expect(paths).To(ConsistOf("secret/team/app/web", "secret/team/*/web"))
+				})
+			})
+
+			Context("when the pattern matches more than max_paths", func() {
+				BeforeEach(func() {
+					checkRequest.Source.MaxPaths = 1
+				})
+
+				It("exits with error", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, checkTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).To(gbytes.Say("matched more than max_paths"))
+				})
+			})
+		})
+
+		Context("when every version is deleted or destroyed", func() {
+			BeforeEach(func() {
+				server.DestroyKV2Version("kv2/data/atu/foo", 1)
+				server.DeleteKV2Version("kv2/data/atu/foo", 2)
+			})
+
+			It("reports no version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+				var resp []models.Version
+				err := json.Unmarshal(session.Out.Contents(), &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(BeEmpty())
+			})
+		})
+
 		Context("vault address not provided", func() {
 			BeforeEach(func() {
 				err = os.Setenv("VAULT_ADDR", checkRequest.Source.VaultAddr)
@@ -97,6 +402,122 @@ var _ = Describe("Check()", func() {
 		})
 	})
 
+	Context("in pki mode", func() {
+		var last models.Version
+
+		BeforeEach(func() {
+			checkRequest.Source.VaultPaths = nil
+			checkRequest.Source.Mode = "pki"
+			checkRequest.Source.PKI = models.PKI{
+				Role:       "web",
+				CommonName: "web.example.com",
+				TTL:        "1h",
+			}
+			last = models.Version{}
+		})
+
+		check := func() []models.Version {
+			checkRequest.Version = last
+			stdin, err := json.Marshal(checkRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+			var resp []models.Version
+			Expect(json.Unmarshal(session.Out.Contents(), &resp)).To(Succeed())
+			return resp
+		}
+
+		issuedAt := func(t time.Time) models.Version {
+			return models.Version{Path: "pki/issue/web", Version: strconv.FormatInt(t.Unix(), 10)}
+		}
+
+		It("reports the current time when no certificate was issued", func() {
+			resp := check()
+			Expect(resp).To(HaveLen(1))
+			Expect(resp[0].Path).To(Equal("pki/issue/web"))
+
+			issued, err := strconv.ParseInt(resp[0].Version, 10, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Unix(issued, 0)).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("reports the last version until it is due for renewal", func() {
+			last = issuedAt(time.Now().Add(-30 * time.Minute))
+			Expect(check()).To(Equal([]models.Version{last}))
+		})
+
+		It("reports the time the renewal was due, not the time of the check", func() {
+			issued := time.Now().Add(-50 * time.Minute)
+			last = issuedAt(issued)
+
+			// renew_before defaults to a third of the ttl
+			Expect(check()).To(Equal([]models.Version{issuedAt(issued.Add(40 * time.Minute))}))
+		})
+
+		It("reports the current time once a renewal would itself be due", func() {
+			last = issuedAt(time.Now().Add(-10 * time.Hour))
+
+			resp := check()
+			issued, err := strconv.ParseInt(resp[0].Version, 10, 64)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Unix(issued, 0)).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+	})
+
+	Context("when vault denies access to the secret", func() {
+		BeforeEach(func() {
+			server.Fail("kv2/metadata/atu/foo", 403)
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, checkTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("error occured reading paths"))
+		})
+	})
+
+	Context("when child_token is set", func() {
+		BeforeEach(func() {
+			checkRequest.Source.ChildToken = true
+			stdinContents, err = json.Marshal(checkRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("checks without creating a token", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, checkTimeout).Should(gexec.Exit(0))
+
+			Expect(server.Tokens()).To(BeEmpty())
+		})
+	})
+
+	Context("when vault is sealed", func() {
+		BeforeEach(func() {
+			server.Seal()
+
+			checkRequest.Source.MinBackoff = "10ms"
+			checkRequest.Source.MaxBackoff = "10ms"
+			stdinContents, err = json.Marshal(checkRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, checkTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("Vault is sealed"))
+		})
+	})
+
 	Context("when resource configuration validation fails", func() {
 		BeforeEach(func() {
 			checkRequest.Source.VaultPaths = make(map[string]int, 0)
@@ -19,15 +19,29 @@ type FakeVault struct {
 	checkReturnsOnCall map[int]struct {
 		result1 []models.Version
 	}
-	InStub        func() error
+	InStub        func() (models.Metadata, error)
 	inMutex       sync.RWMutex
 	inArgsForCall []struct {
 	}
 	inReturns struct {
-		result1 error
+		result1 models.Metadata
+		result2 error
 	}
 	inReturnsOnCall map[int]struct {
-		result1 error
+		result1 models.Metadata
+		result2 error
+	}
+	OutStub        func() (models.Response, error)
+	outMutex       sync.RWMutex
+	outArgsForCall []struct {
+	}
+	outReturns struct {
+		result1 models.Response
+		result2 error
+	}
+	outReturnsOnCall map[int]struct {
+		result1 models.Response
+		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
@@ -85,7 +99,7 @@ func (fake *FakeVault) CheckReturnsOnCall(i int, result1 []models.Version) {
 	}{result1}
 }
 
-func (fake *FakeVault) In() error {
+func (fake *FakeVault) In() (models.Metadata, error) {
 	fake.inMutex.Lock()
 	ret, specificReturn := fake.inReturnsOnCall[len(fake.inArgsForCall)]
 	fake.inArgsForCall = append(fake.inArgsForCall, struct {
@@ -96,10 +110,10 @@ func (fake *FakeVault) In() error {
 		return fake.InStub()
 	}
 	if specificReturn {
-		return ret.result1
+		return ret.result1, ret.result2
 	}
 	fakeReturns := fake.inReturns
-	return fakeReturns.result1
+	return fakeReturns.result1, fakeReturns.result2
 }
 
 func (fake *FakeVault) InCallCount() int {
@@ -108,33 +122,91 @@ func (fake *FakeVault) InCallCount() int {
 	return len(fake.inArgsForCall)
 }
 
-func (fake *FakeVault) InCalls(stub func() error) {
+func (fake *FakeVault) InCalls(stub func() (models.Metadata, error)) {
 	fake.inMutex.Lock()
 	defer fake.inMutex.Unlock()
 	fake.InStub = stub
 }
 
-func (fake *FakeVault) InReturns(result1 error) {
+func (fake *FakeVault) InReturns(result1 models.Metadata, result2 error) {
 	fake.inMutex.Lock()
 	defer fake.inMutex.Unlock()
 	fake.InStub = nil
 	fake.inReturns = struct {
-		result1 error
-	}{result1}
+		result1 models.Metadata
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *FakeVault) InReturnsOnCall(i int, result1 error) {
+func (fake *FakeVault) InReturnsOnCall(i int, result1 models.Metadata, result2 error) {
 	fake.inMutex.Lock()
 	defer fake.inMutex.Unlock()
 	fake.InStub = nil
 	if fake.inReturnsOnCall == nil {
 		fake.inReturnsOnCall = make(map[int]struct {
-			result1 error
+			result1 models.Metadata
+			result2 error
 		})
 	}
 	fake.inReturnsOnCall[i] = struct {
-		result1 error
-	}{result1}
+		result1 models.Metadata
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeVault) Out() (models.Response, error) {
+	fake.outMutex.Lock()
+	ret, specificReturn := fake.outReturnsOnCall[len(fake.outArgsForCall)]
+	fake.outArgsForCall = append(fake.outArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Out", []interface{}{})
+	fake.outMutex.Unlock()
+	if fake.OutStub != nil {
+		return fake.OutStub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.outReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeVault) OutCallCount() int {
+	fake.outMutex.RLock()
+	defer fake.outMutex.RUnlock()
+	return len(fake.outArgsForCall)
+}
+
+func (fake *FakeVault) OutCalls(stub func() (models.Response, error)) {
+	fake.outMutex.Lock()
+	defer fake.outMutex.Unlock()
+	fake.OutStub = stub
+}
+
+func (fake *FakeVault) OutReturns(result1 models.Response, result2 error) {
+	fake.outMutex.Lock()
+	defer fake.outMutex.Unlock()
+	fake.OutStub = nil
+	fake.outReturns = struct {
+		result1 models.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeVault) OutReturnsOnCall(i int, result1 models.Response, result2 error) {
+	fake.outMutex.Lock()
+	defer fake.outMutex.Unlock()
+	fake.OutStub = nil
+	if fake.outReturnsOnCall == nil {
+		fake.outReturnsOnCall = make(map[int]struct {
+			result1 models.Response
+			result2 error
+		})
+	}
+	fake.outReturnsOnCall[i] = struct {
+		result1 models.Response
+		result2 error
+	}{result1, result2}
 }
 
 func (fake *FakeVault) Invocations() map[string][][]interface{} {
@@ -144,6 +216,8 @@ func (fake *FakeVault) Invocations() map[string][][]interface{} {
 	defer fake.checkMutex.RUnlock()
 	fake.inMutex.RLock()
 	defer fake.inMutex.RUnlock()
+	fake.outMutex.RLock()
+	defer fake.outMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,45 @@
+package fakes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+)
+
+// Proxy - an in-process http proxy which forwards every request to a
+// VaultServer, whatever host it was made to
+type Proxy struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	hosts []string
+}
+
+// NewProxy - starts a proxy in front of a VaultServer
+func NewProxy(target *VaultServer) *Proxy {
+	u, _ := url.Parse(target.URL)
+	forward := httputil.NewSingleHostReverseProxy(u)
+
+	p := &Proxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			p.mu.Lock()
+			p.hosts = append(p.hosts, req.Host)
+			p.mu.Unlock()
+
+			forward.ServeHTTP(w, req)
+		},
+	))
+
+	return p
+}
+
+// Hosts - the hosts of the requests made through the proxy
+func (p *Proxy) Hosts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.hosts...)
+}
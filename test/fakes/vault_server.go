@@ -0,0 +1,1234 @@
+package fakes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RootToken - the token a VaultServer accepts from the start
+const RootToken = "r00tT0k3n"
+
+// mount types served by a VaultServer
+const (
+	mountKV1      = "kv1"
+	mountKV2      = "kv2"
+	mountDatabase = "database"
+	mountPKI      = "pki"
+	mountTransit  = "transit"
+	mountSSH      = "ssh"
+)
+
+// the standby states of a VaultServer
+const (
+	standbyNode        = "standby"
+	standbyPerformance = "performance"
+)
+
+// Request - a request received by a VaultServer
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// Token - a token issued by a VaultServer
+type Token struct {
+	Token       string
+	Accessor    string
+	DisplayName string
+	Meta        map[string]string
+	Parent      string
+	Revoked     bool
+}
+
+// Lease - a lease issued by a VaultServer to a token
+type Lease struct {
+	ID       string
+	Token    string
+	Renewals int
+	Revoked  bool
+}
+
+// kv2Version - a version of a kv2 secret
+type kv2Version struct {
+	data      map[string]interface{}
+	created   time.Time
+	deleted   time.Time
+	destroyed bool
+}
+
+// kv2Secret - a kv2 secret and its metadata
+type kv2Secret struct {
+	versions []*kv2Version
+	custom   map[string]string
+}
+
+// appRole - an approle role and the secret ids issued against it
+type appRole struct {
+	roleID    string
+	secretIDs map[string]map[string]string
+}
+
+// VaultServer - an in-process fake of the vault http api. it serves a kv1
+// mount at secret/, kv2 mounts at kv2/ and appdata/, a database mount at
+// database/, a pki mount at pki/, a transit mount at transit/, an ssh mount
+// at ssh/, approle and token auth, leases and sys/health, and fails requests
+// on demand
+type VaultServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	mounts   map[string]string
+	kv1      map[string]map[string]interface{}
+	kv2      map[string]*kv2Secret
+	roles    map[string]*appRole
+	policies map[string]bool
+	ca       *certificateAuthority
+	sshCA    ssh.Signer
+	maxTTL   time.Duration
+	tokens   map[string]*Token
+	leases   map[string]*Lease
+	failures map[string]int
+	failFor  map[string]int
+	failPuts map[string]int
+	requests []Request
+	sealed   bool
+	standby  string
+	autoAuth bool
+	noPatch  bool
+	serial   int
+
+	flight      sync.Mutex
+	latency     time.Duration
+	inFlight    int
+	maxInFlight int
+}
+
+// NewVaultServer - starts a fake vault server which accepts RootToken
+func NewVaultServer() *VaultServer {
+	s := newVaultServer()
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// NewUnixVaultServer - starts a fake vault server which accepts RootToken on
+// a unix socket, as a vault agent listener does
+func NewUnixVaultServer(socket string) (*VaultServer, error) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newVaultServer()
+	s.Server = httptest.NewUnstartedServer(s)
+	s.Server.Listener.Close()
+	s.Server.Listener = l
+	s.Server.Start()
+
+	return s, nil
+}
+
+// newVaultServer - a fake vault server which is not yet listening
+func newVaultServer() *VaultServer {
+	s := &VaultServer{
+		mounts: map[string]string{
+			"secret/":   mountKV1,
+			"kv2/":      mountKV2,
+			"appdata/":  mountKV2,
+			"database/": mountDatabase,
+			"pki/":      mountPKI,
+			"transit/":  mountTransit,
+			"ssh/":      mountSSH,
+		},
+		kv1:      make(map[string]map[string]interface{}, 0),
+		kv2:      make(map[string]*kv2Secret, 0),
+		roles:    make(map[string]*appRole, 0),
+		policies: make(map[string]bool, 0),
+		tokens:   make(map[string]*Token, 0),
+		leases:   make(map[string]*Lease, 0),
+		failures: make(map[string]int, 0),
+		failFor:  make(map[string]int, 0),
+		failPuts: make(map[string]int, 0),
+	}
+	s.tokens[RootToken] = &Token{
+		Token:       RootToken,
+		Accessor:    "root-accessor",
+		DisplayName: "root",
+	}
+
+	return s
+}
+
+// WriteKV1 - writes a secret to the kv1 mount, e.g. secret/foo
+func (s *VaultServer) WriteKV1(p string, data map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kv1[strings.Trim(p, "/")] = data
+}
+
+// WriteKV2 - writes a new version of a secret to the kv2 mount, e.g.
+// kv2/data/foo, returning the version written
+func (s *VaultServer) WriteKV2(p string, data map[string]interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeKV2(s.kv2Key(p), data)
+}
+
+// ReadKV2 - the data of a version of a kv2 secret, or the current version
+// when version is 0
+func (s *VaultServer) ReadKV2(p string, version int) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.kv2Version(s.kv2Key(p), version)
+	if v == nil {
+		return nil
+	}
+	return v.data
+}
+
+// CurrentVersion - the current version of a kv2 secret, or 0 if it does not
+// exist
+func (s *VaultServer) CurrentVersion(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, ok := s.kv2[s.kv2Key(p)]; ok {
+		return len(k.versions)
+	}
+	return 0
+}
+
+// DeleteKV2Version - soft deletes a version of a kv2 secret
+func (s *VaultServer) DeleteKV2Version(p string, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v := s.kv2Version(s.kv2Key(p), version); v != nil {
+		v.deleted = time.Now().UTC()
+	}
+}
+
+// DestroyKV2Version - permanently destroys a version of a kv2 secret
+func (s *VaultServer) DestroyKV2Version(p string, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v := s.kv2Version(s.kv2Key(p), version); v != nil {
+		v.data = nil
+		v.destroyed = true
+	}
+}
+
+// VersionState - whether a version of a kv2 secret is deleted and whether
+// it is destroyed
+func (s *VaultServer) VersionState(p string, version int) (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.kv2Version(s.kv2Key(p), version)
+	if v == nil {
+		return false, false
+	}
+	return !v.deleted.IsZero(), v.destroyed
+}
+
+// ReadKV1 - the data of a kv1 secret
+func (s *VaultServer) ReadKV1(p string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.kv1[strings.Trim(p, "/")]
+}
+
+// SetCustomMetadata - sets the custom_metadata of a kv2 secret
+func (s *VaultServer) SetCustomMetadata(p string, custom map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, ok := s.kv2[s.kv2Key(p)]; ok {
+		k.custom = custom
+	}
+}
+
+// AddAppRole - adds an approle role, returning its role_id and a secret_id
+func (s *VaultServer) AddAppRole(name string) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role := &appRole{
+		roleID:    fmt.Sprintf("role-id-%s", name),
+		secretIDs: make(map[string]map[string]string, 0),
+	}
+	s.roles[name] = role
+
+	secretID := s.next("secret-id")
+	role.secretIDs[secretID] = nil
+
+	return role.roleID, secretID
+}
+
+// AddPasswordPolicy - adds a password policy whose generate endpoint returns
+// a unique value prefixed with its name
+func (s *VaultServer) AddPasswordPolicy(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[name] = true
+}
+
+// Tokens - the tokens issued since the server started, excluding RootToken
+func (s *VaultServer) Tokens() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tokens []Token
+	for _, t := range s.tokens {
+		if t.Token != RootToken {
+			tokens = append(tokens, *t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Token < tokens[j].Token
+	})
+
+	return tokens
+}
+
+// Lease - a lease issued by the database mount
+func (s *VaultServer) Lease(id string) (Lease, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.leases[id]
+	if !ok {
+		return Lease{}, false
+	}
+	return *l, true
+}
+
+// Fail - fails every request to a path, or to any path beneath it, with a
+// status code
+func (s *VaultServer) Fail(p string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[strings.Trim(p, "/")] = status
+}
+
+// FailTimes - fails the next n requests to a path, or to any path beneath
+// it, with a status code
+func (s *VaultServer) FailTimes(p string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[strings.Trim(p, "/")] = status
+	s.failFor[strings.Trim(p, "/")] = n
+}
+
+// FailWrites - fails every PUT or POST to a path with a status code, leaving
+// reads of it alone
+func (s *VaultServer) FailWrites(p string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failPuts[strings.Trim(p, "/")] = status
+}
+
+// Seal - seals the server, failing every request with a 503
+func (s *VaultServer) Seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sealed = true
+}
+
+// Standby - makes the server a standby node, or a performance standby node
+// when performance is set. standbys still serve requests
+func (s *VaultServer) Standby(performance bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.standby = standbyNode
+	if performance {
+		s.standby = standbyPerformance
+	}
+}
+
+// UseAutoAuthToken - treats requests without a token as carrying RootToken,
+// as a vault agent listener with use_auto_auth_token does
+func (s *VaultServer) UseAutoAuthToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.autoAuth = true
+}
+
+// DisablePatch - fails kv2 patches with a 405, as vaults which predate the
+// patch endpoint do
+func (s *VaultServer) DisablePatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.noPatch = true
+}
+
+// SetLatency - delays every response by d. requests wait outside the
+// server's lock, so concurrent requests are in flight together
+func (s *VaultServer) SetLatency(d time.Duration) {
+	s.flight.Lock()
+	defer s.flight.Unlock()
+
+	s.latency = d
+}
+
+// MaxInFlight - the most requests the server has served at once
+func (s *VaultServer) MaxInFlight() int {
+	s.flight.Lock()
+	defer s.flight.Unlock()
+
+	return s.maxInFlight
+}
+
+// Requests - the requests received since the server started
+func (s *VaultServer) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// ServeHTTP - serves the vault http api
+func (s *VaultServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/"), "/")
+	method := req.Method
+	if method == "GET" && req.URL.Query().Get("list") == "true" {
+		method = "LIST"
+	}
+
+	body := make(map[string]interface{}, 0)
+	if b, err := ioutil.ReadAll(req.Body); err == nil {
+		json.Unmarshal(b, &body)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: method,
+		Path:   p,
+		Header: req.Header,
+		Body:   body,
+	})
+	s.mu.Unlock()
+
+	s.wait(req)
+	defer s.done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p == "sys/health" {
+		s.health(w, req)
+		return
+	}
+
+	if s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	for f, status := range s.failures {
+		if p == f || strings.HasPrefix(p, f+"/") {
+			if n, ok := s.failFor[f]; ok {
+				s.failFor[f] = n - 1
+				if n <= 1 {
+					delete(s.failures, f)
+					delete(s.failFor, f)
+				}
+			}
+			respondInjected(w, status, p, body)
+			return
+		}
+	}
+
+	if status, ok := s.failPuts[p]; ok && (method == "PUT" || method == "POST") {
+		respondInjected(w, status, p, body)
+		return
+	}
+
+	if p == "auth/approle/login" {
+		s.appRoleLogin(w, body)
+		return
+	}
+
+	header := req.Header.Get("X-Vault-Token")
+	if len(header) <= 0 && s.autoAuth {
+		header = RootToken
+	}
+
+	token, ok := s.tokens[header]
+	if !ok || token.Revoked {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(p, "sys/internal/ui/mounts/"):
+		s.mountInfo(w, strings.TrimPrefix(p, "sys/internal/ui/mounts/"))
+	case strings.HasPrefix(p, "sys/leases/"):
+		s.lease(w, strings.TrimPrefix(p, "sys/leases/"), body)
+	case strings.HasPrefix(p, "sys/policies/password/"):
+		s.passwordPolicy(w, method, strings.TrimPrefix(p, "sys/policies/password/"))
+	case strings.HasPrefix(p, "auth/token/"):
+		s.token(w, strings.TrimPrefix(p, "auth/token/"), token, body)
+	case strings.HasPrefix(p, "auth/approle/role/"):
+		s.appRole(w, method, strings.TrimPrefix(p, "auth/approle/role/"), body)
+	default:
+		mountPath, mountType := s.mount(p)
+		name := strings.TrimPrefix(p, mountPath)
+		switch mountType {
+		case mountKV1:
+			s.serveKV1(w, method, name, body)
+		case mountKV2:
+			s.serveKV2(w, req, method, mountPath, name, body)
+		case mountDatabase:
+			s.database(w, method, name, token)
+		case mountPKI:
+			s.pki(w, method, name, body)
+		case mountTransit:
+			s.transit(w, method, name, body)
+		case mountSSH:
+			s.sshSign(w, method, name, body)
+		default:
+			respondError(w, http.StatusNotFound, fmt.Sprintf("no handler for route %q", p))
+		}
+	}
+}
+
+// wait - counts a request in flight and waits out the latency, or until the
+// client gives up on the request
+func (s *VaultServer) wait(req *http.Request) {
+	s.flight.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	latency := s.latency
+	s.flight.Unlock()
+
+	select {
+	case <-time.After(latency):
+	case <-req.Context().Done():
+	}
+}
+
+// done - counts a request out of flight
+func (s *VaultServer) done() {
+	s.flight.Lock()
+	defer s.flight.Unlock()
+
+	s.inFlight--
+}
+
+// health - serves sys/health, honouring the status code overrides vault
+// clients send for nodes which cannot serve requests
+func (s *VaultServer) health(w http.ResponseWriter, req *http.Request) {
+	status, override := http.StatusOK, ""
+	switch {
+	case s.sealed:
+		status, override = http.StatusServiceUnavailable, "sealedcode"
+	case s.standby == standbyPerformance:
+		status, override = 473, "performancestandbycode"
+	case s.standby == standbyNode:
+		status, override = 429, "standbycode"
+	}
+
+	if code, err := strconv.Atoi(req.URL.Query().Get(override)); err == nil {
+		status = code
+	}
+
+	respond(w, status, map[string]interface{}{
+		"initialized":         true,
+		"sealed":              s.sealed,
+		"standby":             s.standby != "",
+		"performance_standby": s.standby == standbyPerformance,
+		"version":             "1.1.0",
+	})
+}
+
+// mount - the mount serving a path
+func (s *VaultServer) mount(p string) (string, string) {
+	for m, t := range s.mounts {
+		if strings.HasPrefix(p+"/", m) {
+			return m, t
+		}
+	}
+	return "", ""
+}
+
+// mountInfo - serves sys/internal/ui/mounts
+func (s *VaultServer) mountInfo(w http.ResponseWriter, p string) {
+	m, t := s.mount(p)
+	switch t {
+	case mountKV1:
+		respondData(w, map[string]interface{}{
+			"path": m, "type": "kv", "options": map[string]interface{}{"version": "1"},
+		})
+	case mountKV2:
+		respondData(w, map[string]interface{}{
+			"path": m, "type": "kv", "options": map[string]interface{}{"version": "2"},
+		})
+	case mountDatabase:
+		respondData(w, map[string]interface{}{
+			"path": m, "type": "database", "options": nil,
+		})
+	case mountPKI, mountTransit, mountSSH:
+		respondData(w, map[string]interface{}{
+			"path": m, "type": t, "options": nil,
+		})
+	default:
+		respondError(w, http.StatusForbidden, "preflight capability check returned 403")
+	}
+}
+
+// serveKV1 - serves the kv1 mount
+func (s *VaultServer) serveKV1(
+	w http.ResponseWriter,
+	method, name string,
+	body map[string]interface{},
+) {
+	full := "secret/" + name
+
+	switch method {
+	case "GET":
+		data, ok := s.kv1[full]
+		if !ok {
+			respondError(w, http.StatusNotFound)
+			return
+		}
+		respondData(w, data)
+	case "PUT", "POST":
+		s.kv1[full] = body
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		delete(s.kv1, full)
+		w.WriteHeader(http.StatusNoContent)
+	case "LIST":
+		var names []string
+		for k := range s.kv1 {
+			names = append(names, strings.TrimPrefix(k, "secret/"))
+		}
+		s.list(w, names, name)
+	}
+}
+
+// serveKV2 - serves a kv2 mount. secrets are keyed by their mount and name
+func (s *VaultServer) serveKV2(
+	w http.ResponseWriter,
+	req *http.Request,
+	method, mountPath, p string,
+	body map[string]interface{},
+) {
+	parts := strings.SplitN(p, "/", 2)
+	endpoint, name := parts[0], mountPath
+	if len(parts) > 1 {
+		name = mountPath + parts[1]
+	}
+
+	switch {
+	case endpoint == "data" && method == "GET":
+		version, _ := strconv.Atoi(req.URL.Query().Get("version"))
+		s.readKV2(w, name, version)
+	case endpoint == "data" && (method == "PUT" || method == "POST"):
+		s.putKV2(w, name, body)
+	case endpoint == "data" && method == "PATCH" && !s.noPatch:
+		if req.Header.Get("Content-Type") != "application/merge-patch+json" {
+			respondError(w, http.StatusUnsupportedMediaType, "unsupported content type")
+			return
+		}
+		s.patchKV2(w, name, body)
+	case endpoint == "data" && method == "DELETE":
+		if v := s.kv2Version(name, 0); v != nil {
+			v.deleted = time.Now().UTC()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case (endpoint == "delete" || endpoint == "undelete" || endpoint == "destroy") &&
+		(method == "PUT" || method == "POST"):
+		s.changeKV2Versions(w, endpoint, name, body)
+	case endpoint == "metadata" && method == "DELETE":
+		delete(s.kv2, name)
+		w.WriteHeader(http.StatusNoContent)
+	case endpoint == "metadata" && method == "GET":
+		s.readKV2Metadata(w, name)
+	case endpoint == "metadata" && method == "LIST":
+		var names []string
+		for k := range s.kv2 {
+			if strings.HasPrefix(k, mountPath) {
+				names = append(names, strings.TrimPrefix(k, mountPath))
+			}
+		}
+		s.list(w, names, strings.TrimPrefix(name, mountPath))
+	default:
+		respondError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// readKV2 - serves reads of kv2 data. deleted and destroyed versions are not
+// found, but their metadata is still returned as vault does
+func (s *VaultServer) readKV2(w http.ResponseWriter, name string, version int) {
+	k, ok := s.kv2[name]
+	if !ok {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	if version <= 0 {
+		version = len(k.versions)
+	}
+
+	v := s.kv2Version(name, version)
+	if v == nil {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	data := map[string]interface{}{
+		"data":     v.data,
+		"metadata": versionMetadata(version, v),
+	}
+
+	if !v.deleted.IsZero() || v.destroyed {
+		data["data"] = nil
+		respond(w, http.StatusNotFound, map[string]interface{}{"data": data})
+		return
+	}
+
+	respondData(w, data)
+}
+
+// putKV2 - serves writes of kv2 data, honouring options.cas
+func (s *VaultServer) putKV2(w http.ResponseWriter, name string, body map[string]interface{}) {
+	data, ok := body["data"].(map[string]interface{})
+	if !ok {
+		respondError(w, http.StatusBadRequest, "no data provided")
+		return
+	}
+
+	if !s.checkCAS(w, name, body) {
+		return
+	}
+
+	version := s.writeKV2(name, data)
+	respondData(w, versionMetadata(version, s.kv2Version(name, version)))
+}
+
+// patchKV2 - serves json merge patches of kv2 data, honouring options.cas
+func (s *VaultServer) patchKV2(w http.ResponseWriter, name string, body map[string]interface{}) {
+	patch, ok := body["data"].(map[string]interface{})
+	if !ok {
+		respondError(w, http.StatusBadRequest, "no data provided")
+		return
+	}
+
+	current := s.kv2Version(name, 0)
+	if current == nil || !current.deleted.IsZero() || current.destroyed {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	if !s.checkCAS(w, name, body) {
+		return
+	}
+
+	version := s.writeKV2(name, mergePatch(current.data, patch))
+	respondData(w, versionMetadata(version, s.kv2Version(name, version)))
+}
+
+// changeKV2Versions - serves the delete, undelete and destroy endpoints of
+// kv2 secrets
+func (s *VaultServer) changeKV2Versions(
+	w http.ResponseWriter,
+	endpoint, name string,
+	body map[string]interface{},
+) {
+	versions, _ := body["versions"].([]interface{})
+	if len(versions) <= 0 {
+		respondError(w, http.StatusBadRequest, "no versions provided")
+		return
+	}
+
+	for _, n := range versions {
+		n, _ := n.(float64)
+		v := s.kv2Version(name, int(n))
+		if v == nil || n <= 0 {
+			continue
+		}
+
+		switch endpoint {
+		case "delete":
+			v.deleted = time.Now().UTC()
+		case "undelete":
+			if !v.destroyed {
+				v.deleted = time.Time{}
+			}
+		case "destroy":
+			v.data = nil
+			v.destroyed = true
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCAS - checks the options.cas of a kv2 write against the current
+// version, responding with an error if it does not match
+func (s *VaultServer) checkCAS(w http.ResponseWriter, name string, body map[string]interface{}) bool {
+	options, ok := body["options"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	cas, ok := options["cas"].(float64)
+	if !ok {
+		return true
+	}
+
+	current := 0
+	if k, ok := s.kv2[name]; ok {
+		current = len(k.versions)
+	}
+
+	if int(cas) != current {
+		respondError(w, http.StatusBadRequest,
+			"check-and-set parameter did not match the current version")
+		return false
+	}
+
+	return true
+}
+
+// readKV2Metadata - serves reads of kv2 metadata
+func (s *VaultServer) readKV2Metadata(w http.ResponseWriter, name string) {
+	k, ok := s.kv2[name]
+	if !ok {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	versions := make(map[string]interface{}, len(k.versions))
+	for i, v := range k.versions {
+		m := versionMetadata(i+1, v)
+		delete(m, "version")
+		versions[strconv.Itoa(i+1)] = m
+	}
+
+	respondData(w, map[string]interface{}{
+		"current_version": len(k.versions),
+		"oldest_version":  0,
+		"max_versions":    0,
+		"versions":        versions,
+		"custom_metadata": k.custom,
+		"created_time":    k.versions[0].created.Format(time.RFC3339Nano),
+		"updated_time":    k.versions[len(k.versions)-1].created.Format(time.RFC3339Nano),
+	})
+}
+
+// writeKV2 - adds a version to a kv2 secret
+func (s *VaultServer) writeKV2(name string, data map[string]interface{}) int {
+	k, ok := s.kv2[name]
+	if !ok {
+		k = &kv2Secret{}
+		s.kv2[name] = k
+	}
+
+	k.versions = append(k.versions, &kv2Version{
+		data:    data,
+		created: time.Now().UTC(),
+	})
+
+	return len(k.versions)
+}
+
+// kv2Version - a version of a kv2 secret, or the current version when
+// version is 0
+func (s *VaultServer) kv2Version(name string, version int) *kv2Version {
+	k, ok := s.kv2[name]
+	if !ok {
+		return nil
+	}
+
+	if version <= 0 {
+		version = len(k.versions)
+	}
+
+	if version > len(k.versions) {
+		return nil
+	}
+
+	return k.versions[version-1]
+}
+
+// database - serves the database mount, issuing leased credentials from
+// database/creds/<role>
+func (s *VaultServer) database(w http.ResponseWriter, method, name string, t *Token) {
+	if method != "GET" || !strings.HasPrefix(name, "creds/") {
+		respondError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	role := strings.TrimPrefix(name, "creds/")
+	id := s.next(fmt.Sprintf("database/creds/%s/lease", role))
+	s.leases[id] = &Lease{ID: id, Token: t.Token}
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"lease_id":       id,
+		"lease_duration": 3600,
+		"renewable":      true,
+		"data": map[string]interface{}{
+			"username": s.next(fmt.Sprintf("v-%s", role)),
+			"password": s.next("p4ssw0rd"),
+		},
+	})
+}
+
+// transit - serves the transit mount. ciphertext is the base64 plaintext
+// behind the vault:v1: prefix, so tests can see what was encrypted
+func (s *VaultServer) transit(
+	w http.ResponseWriter,
+	method, name string,
+	body map[string]interface{},
+) {
+	if method != "PUT" && method != "POST" {
+		respondError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(name, "encrypt/"):
+		plaintext, _ := body["plaintext"].(string)
+		respondData(w, map[string]interface{}{"ciphertext": "vault:v1:" + plaintext})
+	case strings.HasPrefix(name, "decrypt/"):
+		ciphertext, _ := body["ciphertext"].(string)
+		if !strings.HasPrefix(ciphertext, "vault:v1:") {
+			respondError(w, http.StatusBadRequest, "invalid ciphertext: no prefix")
+			return
+		}
+		respondData(w, map[string]interface{}{"plaintext": strings.TrimPrefix(ciphertext, "vault:v1:")})
+	default:
+		respondError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// Ciphertext - the ciphertext the transit mount encrypts plaintext to
+func Ciphertext(plaintext string) string {
+	return "vault:v1:" + base64.StdEncoding.EncodeToString([]byte(plaintext))
+}
+
+// passwordPolicy - serves the generate endpoint of sys/policies/password
+func (s *VaultServer) passwordPolicy(w http.ResponseWriter, method, p string) {
+	name := strings.TrimSuffix(p, "/generate")
+	if method != "GET" || name == p {
+		respondError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.policies[name] {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("policy %q not found", name))
+		return
+	}
+
+	respondData(w, map[string]interface{}{"password": s.next(name)})
+}
+
+// lease - serves sys/leases renew and revoke
+func (s *VaultServer) lease(w http.ResponseWriter, action string, body map[string]interface{}) {
+	id, _ := body["lease_id"].(string)
+	l, ok := s.leases[id]
+	if !ok || l.Revoked {
+		respondError(w, http.StatusBadRequest, "invalid lease")
+		return
+	}
+
+	switch action {
+	case "renew":
+		l.Renewals++
+		respond(w, http.StatusOK, map[string]interface{}{
+			"lease_id":       id,
+			"lease_duration": 3600,
+			"renewable":      true,
+		})
+	case "revoke":
+		l.Revoked = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// token - serves auth/token
+func (s *VaultServer) token(
+	w http.ResponseWriter,
+	action string,
+	t *Token,
+	body map[string]interface{},
+) {
+	switch action {
+	case "lookup-self":
+		respondData(w, map[string]interface{}{
+			"accessor":     t.Accessor,
+			"display_name": t.DisplayName,
+			"meta":         t.Meta,
+		})
+	case "renew-self":
+		respondAuth(w, t)
+	case "revoke-self":
+		s.revoke(t)
+		w.WriteHeader(http.StatusNoContent)
+	case "create":
+		meta := make(map[string]string, 0)
+		if m, ok := body["meta"].(map[string]interface{}); ok {
+			for k, v := range m {
+				meta[k] = fmt.Sprintf("%v", v)
+			}
+		}
+		name, _ := body["display_name"].(string)
+		respondAuth(w, s.issue(fmt.Sprintf("token-%s", name), meta, t.Token))
+	default:
+		respondError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// revoke - revokes a token along with its child tokens and the leases they
+// created, as vault does
+func (s *VaultServer) revoke(t *Token) {
+	t.Revoked = true
+
+	for _, l := range s.leases {
+		if l.Token == t.Token {
+			l.Revoked = true
+		}
+	}
+
+	for _, child := range s.tokens {
+		if child.Parent == t.Token && !child.Revoked {
+			s.revoke(child)
+		}
+	}
+}
+
+// appRole - serves the role-id and secret-id endpoints of approle roles
+func (s *VaultServer) appRole(
+	w http.ResponseWriter,
+	method, p string,
+	body map[string]interface{},
+) {
+	parts := strings.SplitN(p, "/", 2)
+	role, ok := s.roles[parts[0]]
+	if !ok || len(parts) < 2 {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case parts[1] == "role-id" && method == "GET":
+		respondData(w, map[string]interface{}{"role_id": role.roleID})
+	case parts[1] == "secret-id" && (method == "PUT" || method == "POST"):
+		meta := make(map[string]string, 0)
+		if m, ok := body["metadata"].(string); ok {
+			if err := json.Unmarshal([]byte(m), &meta); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid metadata")
+				return
+			}
+		}
+		secretID := s.next("secret-id")
+		role.secretIDs[secretID] = meta
+		respondData(w, map[string]interface{}{
+			"secret_id":          secretID,
+			"secret_id_accessor": s.next("secret-id-accessor"),
+		})
+	default:
+		respondError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// appRoleLogin - serves auth/approle/login, attaching the metadata of the
+// secret_id to the token issued
+func (s *VaultServer) appRoleLogin(w http.ResponseWriter, body map[string]interface{}) {
+	roleID, _ := body["role_id"].(string)
+	secretID, _ := body["secret_id"].(string)
+
+	for name, role := range s.roles {
+		if role.roleID != roleID {
+			continue
+		}
+		meta, ok := role.secretIDs[secretID]
+		if !ok {
+			break
+		}
+		respondAuth(w, s.issue(fmt.Sprintf("approle-%s", name), meta, ""))
+		return
+	}
+
+	respondError(w, http.StatusBadRequest, "invalid role or secret ID")
+}
+
+// issue - issues a token
+func (s *VaultServer) issue(displayName string, meta map[string]string, parent string) *Token {
+	t := &Token{
+		Token:       s.next("s.token"),
+		Accessor:    s.next("accessor"),
+		DisplayName: displayName,
+		Meta:        meta,
+		Parent:      parent,
+	}
+	s.tokens[t.Token] = t
+
+	return t
+}
+
+// list - serves a list of the keys directly beneath dir, folders ending in /
+func (s *VaultServer) list(w http.ResponseWriter, names []string, dir string) {
+	prefix := strings.Trim(dir, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+
+	seen := make(map[string]bool, 0)
+	var keys []string
+	for _, n := range names {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		key := strings.TrimPrefix(n, prefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) <= 0 {
+		respondError(w, http.StatusNotFound)
+		return
+	}
+	sort.Strings(keys)
+
+	respondData(w, map[string]interface{}{"keys": keys})
+}
+
+// next - a unique value with a prefix
+func (s *VaultServer) next(prefix string) string {
+	s.serial++
+	return fmt.Sprintf("%s-%d", prefix, s.serial)
+}
+
+// kv2Key - the key of a kv2 secret, its mount followed by its name, from a
+// path which includes the mount and may include an endpoint
+func (s *VaultServer) kv2Key(p string) string {
+	m, _ := s.mount(strings.Trim(p, "/"))
+	name := strings.TrimPrefix(strings.Trim(p, "/"), m)
+	for _, e := range []string{"data/", "metadata/", "delete/", "undelete/", "destroy/"} {
+		if strings.HasPrefix(name, e) {
+			return m + strings.TrimPrefix(name, e)
+		}
+	}
+	return m + name
+}
+
+// mergePatch - applies a json merge patch to a map
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(target)+len(patch))
+	for k, v := range target {
+		merged[k] = v
+	}
+
+	for k, v := range patch {
+		switch t := v.(type) {
+		case nil:
+			delete(merged, k)
+		case map[string]interface{}:
+			m, _ := merged[k].(map[string]interface{})
+			merged[k] = mergePatch(m, t)
+		default:
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// versionMetadata - the metadata of a kv2 version as vault reports it
+func versionMetadata(version int, v *kv2Version) map[string]interface{} {
+	deleted := ""
+	if !v.deleted.IsZero() {
+		deleted = v.deleted.Format(time.RFC3339Nano)
+	}
+
+	return map[string]interface{}{
+		"version":       version,
+		"created_time":  v.created.Format(time.RFC3339Nano),
+		"deletion_time": deleted,
+		"destroyed":     v.destroyed,
+	}
+}
+
+// respond - writes a json response
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// respondData - writes a secret response
+func respondData(w http.ResponseWriter, data map[string]interface{}) {
+	respond(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+// respondAuth - writes an auth response for a token
+func respondAuth(w http.ResponseWriter, t *Token) {
+	respond(w, http.StatusOK, map[string]interface{}{
+		"auth": map[string]interface{}{
+			"client_token":   t.Token,
+			"accessor":       t.Accessor,
+			"metadata":       t.Meta,
+			"lease_duration": 3600,
+			"renewable":      true,
+		},
+	})
+}
+
+// respondError - writes an error response
+func respondError(w http.ResponseWriter, status int, errs ...string) {
+	if errs == nil {
+		errs = []string{}
+	}
+	respond(w, status, map[string]interface{}{"errors": errs})
+}
+
+// respondInjected - writes an injected error for a path, echoing the request
+// body like vault's errors for invalid requests do
+func respondInjected(w http.ResponseWriter, status int, p string, body map[string]interface{}) {
+	msg := fmt.Sprintf("injected error for %s", p)
+	if len(body) > 0 {
+		b, _ := json.Marshal(body)
+		msg = fmt.Sprintf("%s, request body %s", msg, b)
+	}
+	respondError(w, status, msg)
+}
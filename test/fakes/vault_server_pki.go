@@ -0,0 +1,155 @@
+package fakes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// certificateAuthority - the ca a VaultServer issues certificates from
+type certificateAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+// SetMaxTTL - caps the lifetime of issued certificates, as the max_ttl of a
+// pki role does
+func (s *VaultServer) SetMaxTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxTTL = ttl
+}
+
+// authority - the ca of the pki mount, created on first use
+func (s *VaultServer) authority() (*certificateAuthority, error) {
+	if s.ca != nil {
+		return s.ca, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake vault ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * 365 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ca = &certificateAuthority{
+		cert: cert,
+		key:  key,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+
+	return s.ca, nil
+}
+
+// pki - serves the pki mount, issuing certificates from pki/issue/<role>.
+// not_after takes precedence over ttl, and both are capped by SetMaxTTL
+func (s *VaultServer) pki(
+	w http.ResponseWriter,
+	method, name string,
+	body map[string]interface{},
+) {
+	if (method != "PUT" && method != "POST") || !strings.HasPrefix(name, "issue/") {
+		respondError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now().UTC()
+	notAfter := now.Add(time.Hour)
+	if ttl, ok := body["ttl"].(string); ok {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			notAfter = now.Add(d)
+		}
+	}
+	if na, ok := body["not_after"].(string); ok {
+		t, err := time.Parse(time.RFC3339, na)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid not_after: %v", err))
+			return
+		}
+		notAfter = t
+	}
+	if s.maxTTL > 0 && notAfter.After(now.Add(s.maxTTL)) {
+		notAfter = now.Add(s.maxTTL)
+	}
+
+	ca, err := s.authority()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.serial++
+	commonName, _ := body["common_name"].(string)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.serial) + 1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-30 * time.Second),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if altNames, ok := body["alt_names"].(string); ok && len(altNames) > 0 {
+		template.DNSNames = strings.Split(altNames, ",")
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	serial := make([]string, 0)
+	for _, b := range template.SerialNumber.Bytes() {
+		serial = append(serial, fmt.Sprintf("%02x", b))
+	}
+
+	respondData(w, map[string]interface{}{
+		"certificate":      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"private_key":      string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		"private_key_type": "ec",
+		"issuing_ca":       ca.pem,
+		"ca_chain":         []string{ca.pem},
+		"serial_number":    strings.Join(serial, ":"),
+		"expiration":       notAfter.Unix(),
+	})
+}
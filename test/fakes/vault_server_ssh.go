@@ -0,0 +1,102 @@
+package fakes
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHCA - the public key of the ca the ssh mount signs keys with
+func (s *VaultServer) SSHCA() ssh.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	signer, err := s.sshAuthority()
+	if err != nil {
+		return nil
+	}
+	return signer.PublicKey()
+}
+
+// sshAuthority - the ca of the ssh mount, created on first use
+func (s *VaultServer) sshAuthority() (ssh.Signer, error) {
+	if s.sshCA != nil {
+		return s.sshCA, nil
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sshCA, err = ssh.NewSignerFromKey(key)
+	return s.sshCA, err
+}
+
+// sshSign - serves the ssh mount, signing public keys at ssh/sign/<role>
+func (s *VaultServer) sshSign(
+	w http.ResponseWriter,
+	method, name string,
+	body map[string]interface{},
+) {
+	if (method != "PUT" && method != "POST") || !strings.HasPrefix(name, "sign/") {
+		respondError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	publicKey, _ := body["public_key"].(string)
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse public_key as SSH key: %v", err))
+		return
+	}
+
+	ttl := time.Hour
+	if v, ok := body["ttl"].(string); ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			ttl = d
+		}
+	}
+
+	certType := uint32(ssh.UserCert)
+	if body["cert_type"] == "host" {
+		certType = ssh.HostCert
+	}
+
+	var principals []string
+	if v, ok := body["valid_principals"].(string); ok && len(v) > 0 {
+		principals = strings.Split(v, ",")
+	}
+
+	signer, err := s.sshAuthority()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.serial++
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          uint64(s.serial),
+		CertType:        certType,
+		KeyId:           fmt.Sprintf("vault-%s", strings.TrimPrefix(name, "sign/")),
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-30 * time.Second).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondData(w, map[string]interface{}{
+		"signed_key":    string(ssh.MarshalAuthorizedKey(cert)),
+		"serial_number": fmt.Sprintf("%016x", cert.Serial),
+	})
+}
@@ -1,15 +1,26 @@
 package test
 
 import (
+	"bytes"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"io/ioutil"
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+	"github.com/comcast/concourse-vault-resource/test/fakes"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 )
@@ -83,6 +94,1738 @@ var _ = Describe("In", func() {
 			Expect(response.Version.Version).NotTo(BeEmpty())
 		})
 
+		It("writes the current version of a kv2 secret", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+			Expect(secrets).To(Equal(map[string]interface{}{
+				"username": "atu",
+				"password": "n3w-p4ssw0rd",
+			}))
+		})
+
+		Context("when an older version is pinned", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/data/atu/foo": 1,
+				}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the pinned version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+			})
+		})
+
+		Context("when concourse asks for an older version", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/data/atu/foo": -1,
+				}
+				inRequest.Version = models.Version{
+					Path:    "kv2/data/atu/foo",
+					Version: "1",
+				}
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the version concourse asked for", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+
+				response := models.Response{}
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.Version).To(Equal(inRequest.Version))
+			})
+
+			Context("and the version carries a custom_metadata digest", func() {
+				BeforeEach(func() {
+					inRequest.Version.Version = "1+0123456789ab"
+				})
+
+				It("writes the version before the digest", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+				})
+			})
+
+			Context("and the path is pinned to a version", func() {
+				BeforeEach(func() {
+					inRequest.Source.VaultPaths = map[string]int{
+						"kv2/data/atu/foo": 1,
+					}
+					inRequest.Version.Version = "2"
+				})
+
+				It("writes the pinned version", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+				})
+			})
+
+			Context("and it is for another path", func() {
+				BeforeEach(func() {
+					inRequest.Version.Path = "kv2/data/atu/bar"
+				})
+
+				It("writes the current version", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(HaveKeyWithValue("password", "n3w-p4ssw0rd"))
+				})
+			})
+		})
+
+		Context("when the pinned version is deleted and fallback_to_readable is set", func() {
+			BeforeEach(func() {
+				server.DeleteKV2Version("kv2/data/atu/foo", 2)
+
+				inRequest.Source.FallbackToReadable = true
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the newest readable version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+			})
+		})
+
+		Context("when check_metadata is set", func() {
+			BeforeEach(func() {
+				server.SetCustomMetadata("kv2/data/atu/foo", map[string]string{
+					"owner":      "atu",
+					"deprecated": "true",
+				})
+
+				inRequest.Source.CheckMetadata = []string{"deprecated", "rotated"}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the chosen keys to the metadata file", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				metadata := readSecrets(filepath.Join(destDirectory, "metadata"))
+				Expect(metadata).To(Equal(map[string]interface{}{
+					"kv2/data/atu/foo": map[string]interface{}{
+						"deprecated": "true",
+					},
+				}))
+			})
+
+			Context("and several paths share a key", func() {
+				BeforeEach(func() {
+					server.WriteKV2("kv2/data/atu/other", map[string]interface{}{
+						"token": "0th3r-t0k3n",
+					})
+					server.SetCustomMetadata("kv2/data/atu/other", map[string]string{
+						"deprecated": "false",
+					})
+
+					inRequest.Source.VaultPaths["kv2/data/atu/other"] = 0
+
+					var err error
+					stdinContents, err = json.Marshal(inRequest)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+
+				It("writes the keys of each path apart", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					metadata := readSecrets(filepath.Join(destDirectory, "metadata"))
+					Expect(metadata).To(Equal(map[string]interface{}{
+						"kv2/data/atu/foo": map[string]interface{}{
+							"deprecated": "true",
+						},
+						"kv2/data/atu/other": map[string]interface{}{
+							"deprecated": "false",
+						},
+					}))
+				})
+			})
+		})
+
+		Context("when the name of the mount contains data", func() {
+			BeforeEach(func() {
+				server.WriteKV2("appdata/data/atu/foo", map[string]interface{}{
+					"password": "0ld-p4ssw0rd",
+				})
+				server.WriteKV2("appdata/data/atu/foo", map[string]interface{}{
+					"password": "n3w-p4ssw0rd",
+				})
+				server.DeleteKV2Version("appdata/data/atu/foo", 2)
+				server.SetCustomMetadata("appdata/data/atu/foo", map[string]string{
+					"deprecated": "true",
+				})
+
+				inRequest.Source.VaultPaths = map[string]int{
+					"appdata/data/atu/foo": 2,
+				}
+				inRequest.Source.FallbackToReadable = true
+				inRequest.Source.CheckMetadata = []string{"deprecated"}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("falls back using the metadata of the secret on that mount", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "0ld-p4ssw0rd"))
+			})
+
+			It("writes the chosen keys of the secret on that mount", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				metadata := readSecrets(filepath.Join(destDirectory, "metadata"))
+				Expect(metadata).To(Equal(map[string]interface{}{
+					"appdata/data/atu/foo": map[string]interface{}{
+						"deprecated": "true",
+					},
+				}))
+			})
+		})
+
+		Context("when flatten is set", func() {
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/atu/nested", map[string]interface{}{
+					"db": map[string]interface{}{
+						"primary-host": "db.example.com",
+						"ports":        []interface{}{5432, 5433},
+						"options":      map[string]interface{}{},
+					},
+					"hosts": []interface{}{
+						map[string]interface{}{"name": "web-1"},
+					},
+				})
+
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/data/atu/nested": 0,
+				}
+				inRequest.Source.Flatten = true
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("joins nested map keys and list indices with an underscore", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"db_primary-host": "db.example.com",
+					"db_ports_0":      float64(5432),
+					"db_ports_1":      float64(5433),
+					"db_options":      map[string]interface{}{},
+					"hosts_0_name":    "web-1",
+				}))
+			})
+
+			Context("with a flatten_separator", func() {
+				BeforeEach(func() {
+					inRequest.Source.FlattenSeparator = "."
+				})
+
+				It("joins nested keys with the separator", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(HaveKeyWithValue("db.primary-host", "db.example.com"))
+					Expect(secrets).To(HaveKeyWithValue("db.ports.1", float64(5433)))
+					Expect(secrets).To(HaveKeyWithValue("hosts.0.name", "web-1"))
+				})
+			})
+
+			Context("with prefix, sanitize and upcase", func() {
+				BeforeEach(func() {
+					inRequest.Source.FlattenSeparator = "."
+					inRequest.Source.Prefix = "app"
+					inRequest.Source.Sanitize = true
+					inRequest.Source.Upcase = true
+				})
+
+				It("flattens the keys before they are prefixed, sanitized and upcased", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(Equal(map[string]interface{}{
+						"APP_DB_PRIMARY_HOST": "db.example.com",
+						"APP_DB_PORTS_0":      float64(5432),
+						"APP_DB_PORTS_1":      float64(5433),
+						"APP_DB_OPTIONS":      map[string]interface{}{},
+						"APP_HOSTS_0_NAME":    "web-1",
+					}))
+				})
+			})
+
+			Context("with a flattened key which collides with another key", func() {
+				BeforeEach(func() {
+					server.WriteKV2("kv2/data/atu/nested", map[string]interface{}{
+						"db_host": "db-1.example.com",
+						"db": map[string]interface{}{
+							"host": "db-2.example.com",
+						},
+					})
+				})
+
+				It("exits naming the key", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("flattened key db_host collides with another key"))
+
+					Expect(filepath.Join(destDirectory, "secrets")).NotTo(BeAnExistingFile())
+				})
+			})
+		})
+
+		Context("when transit_decrypt is set", func() {
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/atu/sealed", map[string]interface{}{
+					"token": fakes.Ciphertext("t0k3n-s3cr3t"),
+					"db": map[string]interface{}{
+						"password": fakes.Ciphertext("db-p4ssw0rd"),
+						"hosts": []interface{}{
+							fakes.Ciphertext("db-1.internal"),
+							"db-2.example.com",
+						},
+					},
+					"region": "us-east",
+				})
+
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/data/atu/sealed": 0,
+				}
+				inRequest.Source.TransitDecrypt = models.Transit{Key: "deploy"}
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("decrypts ciphertext values, including nested ones", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"token": "t0k3n-s3cr3t",
+					"db": map[string]interface{}{
+						"password": "db-p4ssw0rd",
+						"hosts":    []interface{}{"db-1.internal", "db-2.example.com"},
+					},
+					"region": "us-east",
+				}))
+			})
+
+			It("never prints the decrypted values", func() {
+				inRequest.Source.Debug = true
+				stdin, err := json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Running the command")
+				session := run(command, stdin)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				for _, v := range []string{"t0k3n-s3cr3t", "db-p4ssw0rd", "db-1.internal"} {
+					Expect(string(session.Err.Contents())).NotTo(ContainSubstring(v))
+				}
+			})
+
+			Context("with flatten", func() {
+				BeforeEach(func() {
+					inRequest.Source.Flatten = true
+				})
+
+				It("decrypts the values before they are flattened", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+					Expect(secrets).To(Equal(map[string]interface{}{
+						"token":       "t0k3n-s3cr3t",
+						"db_password": "db-p4ssw0rd",
+						"db_hosts_0":  "db-1.internal",
+						"db_hosts_1":  "db-2.example.com",
+						"region":      "us-east",
+					}))
+				})
+			})
+
+			Context("and a value cannot be decrypted", func() {
+				BeforeEach(func() {
+					server.WriteKV2("kv2/data/atu/sealed", map[string]interface{}{
+						"token": "vault:v2:bm90LWEta2V5",
+					})
+				})
+
+				It("exits naming the key", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("error decrypting token"))
+
+					Expect(filepath.Join(destDirectory, "secrets")).NotTo(BeAnExistingFile())
+				})
+			})
+		})
+
+		Context("when vault_paths contains a pattern", func() {
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/team/app/api", map[string]interface{}{
+					"api-key": "4p1-k3y",
+					"region":  "us-east",
+				})
+				server.WriteKV2("kv2/data/team/app/web", map[string]interface{}{
+					"web-key": "w3b-k3y",
+					"region":  "eu-west",
+				})
+				server.WriteKV2("kv2/data/team/other", map[string]interface{}{
+					"other-key": "0th3r-k3y",
+				})
+
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/team/app/*": 0,
+				}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("merges the secrets it matches in lexical order", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"api-key": "4p1-k3y",
+					"web-key": "w3b-k3y",
+					"region":  "eu-west",
+				}))
+			})
+		})
+
+		Context("when several paths are read", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultPaths = make(map[string]int, 0)
+				for _, name := range []string{"one", "two", "three", "four"} {
+					server.WriteKV2("kv2/data/team/"+name, map[string]interface{}{
+						"key-" + name: "v4lu3-" + name,
+						"shared":      "sh4r3d-" + name,
+					})
+					inRequest.Source.VaultPaths["kv2/data/team/"+name] = 0
+				}
+
+				server.SetLatency(200 * time.Millisecond)
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("reads them concurrently and merges them in lexical order", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(server.MaxInFlight()).To(BeNumerically(">", 1))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"key-one":   "v4lu3-one",
+					"key-two":   "v4lu3-two",
+					"key-three": "v4lu3-three",
+					"key-four":  "v4lu3-four",
+					"shared":    "sh4r3d-two",
+				}))
+			})
+
+			Context("with a concurrency of 1", func() {
+				BeforeEach(func() {
+					inRequest.Source.Concurrency = 1
+				})
+
+				It("reads one path at a time", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					Expect(server.MaxInFlight()).To(Equal(1))
+				})
+			})
+
+			Context("when more than one path fails", func() {
+				BeforeEach(func() {
+					server.Fail("kv2/data/team/one", http.StatusForbidden)
+					server.Fail("kv2/data/team/three", http.StatusForbidden)
+				})
+
+				It("reports every failed path", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					Expect(session.Err).To(gbytes.Say("kv2/data/team/one"))
+					Expect(session.Err).To(gbytes.Say("kv2/data/team/three"))
+				})
+			})
+		})
+
+		Context("when the stderr audit sink is set", func() {
+			BeforeEach(func() {
+				server.WriteKV2("kv2/data/app/config", map[string]interface{}{
+					"api-token": "t0k3n-v4lu3-123",
+					"card":      4111111111111111,
+					"replicas":  2,
+					"region":    "eu",
+					"debug":     true,
+				})
+
+				inRequest.Source.VaultPaths = map[string]int{
+					"kv2/data/app/config": 0,
+					"kv2/data/atu/foo":    0,
+				}
+				inRequest.Source.Audit = models.Audit{Sink: "stderr"}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("records the paths read without redacting their versions", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				var record models.AuditRecord
+				for _, line := range bytes.Split(session.Err.Contents(), []byte("\n")) {
+					if bytes.Contains(line, []byte(`"operation":"in"`)) {
+						Expect(json.Unmarshal(line, &record)).To(Succeed())
+					}
+				}
+
+				Expect(record.Paths).To(ConsistOf(
+					models.Version{Path: "kv2/data/app/config", Version: "1"},
+					models.Version{Path: "kv2/data/atu/foo", Version: "2"},
+				))
+				Expect(record.VaultAddr).To(Equal(vaultAddr))
+				Expect(string(session.Err.Contents())).NotTo(ContainSubstring("[redacted]"))
+			})
+
+			Context("and a value read is logged", func() {
+				BeforeEach(func() {
+					command.Env = append(os.Environ(), "BUILD_PIPELINE_NAME=t0k3n-v4lu3-123")
+				})
+
+				It("redacts the value", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					stderr := string(session.Err.Contents())
+					Expect(stderr).To(ContainSubstring(`"pipeline":"[redacted]"`))
+					Expect(stderr).NotTo(ContainSubstring("t0k3n-v4lu3-123"))
+				})
+			})
+		})
+
+		Context("when the file audit sink is set", func() {
+			var auditDirectory string
+
+			BeforeEach(func() {
+				var err error
+				auditDirectory, err = ioutil.TempDir("", "concourse-vault-audit")
+				Expect(err).NotTo(HaveOccurred())
+
+				inRequest.Source.Audit = models.Audit{
+					Sink: "file",
+					Path: filepath.Join(auditDirectory, "audit.log"),
+				}
+				command.Env = append(os.Environ(), "BUILD_PIPELINE_NAME=deploy")
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(auditDirectory)
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("appends a record for every step", func() {
+				By("Running the command twice")
+				for i := 0; i < 2; i++ {
+					cmd := exec.Command(inPath, destDirectory)
+					cmd.Env = command.Env
+					Eventually(run(cmd, stdinContents), inTimeout).Should(gexec.Exit(0))
+				}
+
+				b, err := ioutil.ReadFile(filepath.Join(auditDirectory, "audit.log"))
+				Expect(err).NotTo(HaveOccurred())
+
+				lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+				Expect(lines).To(HaveLen(2))
+				for _, line := range lines {
+					var record models.AuditRecord
+					Expect(json.Unmarshal(line, &record)).To(Succeed())
+					Expect(record.Operation).To(Equal("in"))
+					Expect(record.Pipeline).To(Equal("deploy"))
+					Expect(record.Identity).To(Equal("root"))
+					Expect(record.Paths).To(Equal([]models.Version{
+						{Path: "kv2/data/atu/foo", Version: "2"},
+					}))
+				}
+
+				By("Validating the record is not written to the build directory")
+				_, err = os.Stat(filepath.Join(destDirectory, "audit.log"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			Context("with a relative path", func() {
+				BeforeEach(func() {
+					inRequest.Source.Audit.Path = "audit.log"
+				})
+
+				It("exits with error", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					Expect(session.Err).To(gbytes.Say("audit.path must be an absolute path"))
+				})
+			})
+		})
+
+		Context("when the vault audit sink is set", func() {
+			auditRecords := func(prefix string) []string {
+				var paths []string
+				for _, req := range server.Requests() {
+					if req.Method == "PUT" && strings.HasPrefix(req.Path, prefix) {
+						paths = append(paths, req.Path)
+					}
+				}
+				return paths
+			}
+
+			BeforeEach(func() {
+				command.Env = append(os.Environ(), "BUILD_ID=1234")
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			Context("on a kv2 mount", func() {
+				BeforeEach(func() {
+					inRequest.Source.Audit = models.Audit{
+						Sink: "vault",
+						Path: "kv2/audit/concourse",
+					}
+				})
+
+				It("writes a secret for the step under the path", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					paths := auditRecords("kv2/data/audit/concourse/1234-in-")
+					Expect(paths).To(HaveLen(1))
+
+					record := server.ReadKV2(paths[0], 0)
+					Expect(record).To(HaveKeyWithValue("operation", "in"))
+					Expect(record).To(HaveKeyWithValue("build_id", "1234"))
+					Expect(record["paths"]).To(Equal([]interface{}{
+						map[string]interface{}{"path": "kv2/data/atu/foo", "version": "2"},
+					}))
+				})
+			})
+
+			Context("on a kv1 mount", func() {
+				BeforeEach(func() {
+					inRequest.Source.Audit = models.Audit{
+						Sink: "vault",
+						Path: "secret/audit",
+					}
+				})
+
+				It("writes a secret for the step under the path", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					paths := auditRecords("secret/audit/1234-in-")
+					Expect(paths).To(HaveLen(1))
+					Expect(server.ReadKV1(paths[0])).To(HaveKeyWithValue("operation", "in"))
+				})
+			})
+
+			Context("when the record cannot be written", func() {
+				BeforeEach(func() {
+					inRequest.Source.Audit = models.Audit{
+						Sink: "vault",
+						Path: "secret/audit",
+					}
+					server.Fail("secret/audit", http.StatusForbidden)
+				})
+
+				It("exits with error", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					Expect(session.Err).To(gbytes.Say("error writing audit record to vault"))
+				})
+			})
+		})
+
+		Context("when a kv1 secret is read", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultPaths = map[string]int{
+					"secret/atu/bar": 0,
+				}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the secret", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"api-key": "k3y",
+				}))
+			})
+		})
+
+		Context("when a dynamic secret is read", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultPaths = map[string]int{
+					"database/creds/readonly": 0,
+				}
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the credentials and their lease", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKey("username"))
+				Expect(secrets).To(HaveKey("password"))
+
+				b, err := ioutil.ReadFile(filepath.Join(destDirectory, "leases"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var leases []models.Lease
+				Expect(json.Unmarshal(b, &leases)).To(Succeed())
+				Expect(leases).To(HaveLen(1))
+				Expect(leases[0].Renewable).To(BeTrue())
+
+				_, ok := server.Lease(leases[0].LeaseID)
+				Expect(ok).To(BeTrue())
+			})
+		})
+
+		Context("when running in a build", func() {
+			BeforeEach(func() {
+				server.AddAppRole("concourse")
+
+				inRequest.Source.RoleName = "concourse"
+				inRequest.Source.ChildToken = true
+
+				command.Env = append(os.Environ(),
+					"BUILD_TEAM_NAME=main",
+					"BUILD_PIPELINE_NAME=deploy",
+					"BUILD_JOB_NAME=release",
+					"BUILD_NAME=42",
+				)
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("sends the build metadata to vault", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				By("Validating every request carries the build headers")
+				for _, req := range server.Requests() {
+					Expect(req.Header.Get("X-Concourse-Job")).To(Equal("release"))
+				}
+
+				By("Validating the tokens issued carry the build metadata")
+				tokens := server.Tokens()
+				Expect(tokens).To(HaveLen(2))
+				for _, t := range tokens {
+					Expect(t.Meta).To(HaveKeyWithValue("concourse_pipeline", "deploy"))
+					Expect(t.Meta).To(HaveKeyWithValue("concourse_build_name", "42"))
+				}
+
+				By("Validating the child token was revoked")
+				Expect(tokens[1].DisplayName).To(Equal("token-concourse"))
+				Expect(tokens[1].Revoked).To(BeTrue())
+			})
+
+			Context("and the step fails", func() {
+				BeforeEach(func() {
+					server.Fail("kv2/data/atu/foo", http.StatusForbidden)
+				})
+
+				It("still revokes the child token", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					tokens := server.Tokens()
+					Expect(tokens).To(HaveLen(2))
+					Expect(tokens[1].DisplayName).To(Equal("token-concourse"))
+					Expect(tokens[1].Revoked).To(BeTrue())
+				})
+			})
+
+			Context("and a dynamic secret is read", func() {
+				BeforeEach(func() {
+					inRequest.Source.VaultPaths = map[string]int{
+						"database/creds/readonly": 0,
+					}
+				})
+
+				It("reads it without a child token, so its lease outlives the step", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					tokens := server.Tokens()
+					Expect(tokens).To(HaveLen(1))
+					Expect(tokens[0].DisplayName).To(Equal("approle-concourse"))
+					Expect(tokens[0].Revoked).To(BeFalse())
+
+					b, err := ioutil.ReadFile(filepath.Join(destDirectory, "leases"))
+					Expect(err).NotTo(HaveOccurred())
+
+					var leases []models.Lease
+					Expect(json.Unmarshal(b, &leases)).To(Succeed())
+					Expect(leases).To(HaveLen(1))
+
+					lease, ok := server.Lease(leases[0].LeaseID)
+					Expect(ok).To(BeTrue())
+					Expect(lease.Token).To(Equal(tokens[0].Token))
+					Expect(lease.Revoked).To(BeFalse())
+				})
+			})
+		})
+
+		It("looks up no mounts for child tokens unless child_token is set", func() {
+			inRequest.Source.Debug = true
+			stdin, err := json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			for _, req := range server.Requests() {
+				Expect(req.Path).NotTo(HavePrefix("sys/internal/ui/mounts/"))
+			}
+			Expect(string(session.Err.Contents())).NotTo(ContainSubstring("child token"))
+		})
+
+		It("writes no versions file unless asked to", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			Expect(filepath.Join(destDirectory, "versions")).NotTo(BeAnExistingFile())
+		})
+
+		Context("when write_versions is set", func() {
+			BeforeEach(func() {
+				inRequest.Params.WriteVersions = true
+			})
+
+			JustBeforeEach(func() {
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("writes the versions of the kv2 secrets read", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				versions := readSecrets(filepath.Join(destDirectory, "versions"))
+				Expect(versions).To(Equal(map[string]interface{}{
+					"kv2/data/atu/foo": float64(2),
+				}))
+			})
+
+			Context("and only kv1 secrets are read", func() {
+				BeforeEach(func() {
+					inRequest.Source.VaultPaths = map[string]int{
+						"secret/atu/bar": 0,
+					}
+				})
+
+				It("writes no versions file", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+					Expect(filepath.Join(destDirectory, "versions")).NotTo(BeAnExistingFile())
+				})
+			})
+		})
+
+		It("writes the secrets file readable only by its owner", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			info, err := os.Stat(filepath.Join(destDirectory, "secrets"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		Context("when secrets_file and file_mode are provided", func() {
+			BeforeEach(func() {
+				inRequest.Source.SecretsFile = "vault.json"
+				inRequest.Source.FileMode = "0640"
+
+				var err error
+				stdinContents, err = json.Marshal(inRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("replaces any existing file with the configured name and mode", func() {
+				dest := filepath.Join(destDirectory, "vault.json")
+				stale := bytes.Repeat([]byte("x"), 64*1024)
+				Expect(ioutil.WriteFile(dest, stale, 0644)).To(Succeed())
+
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				info, err := os.Stat(dest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+				b, err := ioutil.ReadFile(dest)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(json.Valid(b)).To(BeTrue())
+
+				files, err := ioutil.ReadDir(destDirectory)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(HaveLen(1))
+			})
+		})
+	})
+
+	Context("in pki mode", func() {
+		var issued time.Time
+
+		BeforeEach(func() {
+			issued = time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+
+			inRequest.Source.VaultPaths = nil
+			inRequest.Source.Mode = "pki"
+			inRequest.Source.PKI = models.PKI{
+				Role:       "web",
+				CommonName: "web.example.com",
+				AltNames:   []string{"www.example.com"},
+				TTL:        "1h",
+			}
+			inRequest.Version = models.Version{
+				Path:    "pki/issue/web",
+				Version: strconv.FormatInt(issued.Unix(), 10),
+			}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		readCertificate := func(dir string) *x509.Certificate {
+			b, err := ioutil.ReadFile(filepath.Join(dir, "certificate.pem"))
+			Expect(err).NotTo(HaveOccurred())
+
+			block, _ := pem.Decode(b)
+			Expect(block).NotTo(BeNil())
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			return cert
+		}
+
+		It("issues a certificate expiring a ttl after the version", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			cert := readCertificate(destDirectory)
+			Expect(cert.Subject.CommonName).To(Equal("web.example.com"))
+			Expect(cert.DNSNames).To(ConsistOf("www.example.com"))
+			Expect(cert.NotAfter).To(BeTemporally("==", issued.Add(time.Hour)))
+
+			for _, f := range []string{"private_key.pem", "ca_chain.pem", "serial"} {
+				Expect(filepath.Join(destDirectory, f)).To(BeAnExistingFile())
+			}
+
+			info, err := os.Stat(filepath.Join(destDirectory, "private_key.pem"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			response := models.Response{}
+			Expect(json.Unmarshal(session.Out.Contents(), &response)).To(Succeed())
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "expiration", Value: issued.Add(time.Hour).UTC().Format(time.RFC3339),
+			}))
+
+			By("Validating the private key is never printed")
+			key, err := ioutil.ReadFile(filepath.Join(destDirectory, "private_key.pem"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(session.Err.Contents()).NotTo(ContainSubstring(string(key)))
+		})
+
+		It("sends the ttl as a not_after counted from the version", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			var issues []fakes.Request
+			for _, req := range server.Requests() {
+				if req.Path == "pki/issue/web" {
+					issues = append(issues, req)
+				}
+			}
+			Expect(issues).To(HaveLen(1))
+			Expect(issues[0].Body).To(HaveKeyWithValue(
+				"not_after", issued.Add(time.Hour).UTC().Format(time.RFC3339),
+			))
+			Expect(issues[0].Body).NotTo(HaveKey("ttl"))
+		})
+
+		It("issues certificates with the same lifetime to every step fetching the version", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			By("Running the command again for the same version")
+			again, err := ioutil.TempDir("", "concourse-vault-resource")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(again)
+
+			session = run(exec.Command(inPath, again), stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			Expect(readCertificate(again).NotAfter).To(Equal(readCertificate(destDirectory).NotAfter))
+		})
+
+		Context("when the version has expired", func() {
+			BeforeEach(func() {
+				inRequest.Version.Version = strconv.FormatInt(issued.Add(-time.Hour).Unix(), 10)
+			})
+
+			It("exits with error", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("run check for a newer version"))
+			})
+		})
+
+		Context("when the role caps the lifetime of the certificate", func() {
+			BeforeEach(func() {
+				server.SetMaxTTL(30 * time.Minute)
+			})
+
+			It("exits with error", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("check the max_ttl of role web"))
+			})
+		})
+	})
+
+	Context("in ssh mode", func() {
+		BeforeEach(func() {
+			inRequest.Source.VaultPaths = nil
+			inRequest.Source.Mode = "ssh"
+			inRequest.Source.SSH = models.SSH{
+				Role:       "deploy",
+				Principals: []string{"deploy"},
+				TTL:        "1h",
+			}
+
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("writes a key pair and a certificate signed for its public key", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			b, err := ioutil.ReadFile(filepath.Join(destDirectory, "id_rsa.pub"))
+			Expect(err).NotTo(HaveOccurred())
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey(b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publicKey.Type()).To(Equal(ssh.KeyAlgoRSA))
+
+			b, err = ioutil.ReadFile(filepath.Join(destDirectory, "id_rsa"))
+			Expect(err).NotTo(HaveOccurred())
+			privateKey, err := ssh.ParsePrivateKey(b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(privateKey.PublicKey().Marshal()).To(Equal(publicKey.Marshal()))
+
+			b, err = ioutil.ReadFile(filepath.Join(destDirectory, "id_rsa-cert.pub"))
+			Expect(err).NotTo(HaveOccurred())
+			key, _, _, _, err := ssh.ParseAuthorizedKey(b)
+			Expect(err).NotTo(HaveOccurred())
+			cert, ok := key.(*ssh.Certificate)
+			Expect(ok).To(BeTrue())
+
+			By("Validating the certificate is for the public key written")
+			Expect(cert.Key.Marshal()).To(Equal(publicKey.Marshal()))
+			Expect(cert.CertType).To(Equal(uint32(ssh.UserCert)))
+			Expect(cert.ValidPrincipals).To(Equal([]string{"deploy"}))
+
+			By("Validating the certificate is signed by the ssh ca")
+			checker := &ssh.CertChecker{
+				IsUserAuthority: func(auth ssh.PublicKey) bool {
+					return bytes.Equal(auth.Marshal(), server.SSHCA().Marshal())
+				},
+			}
+			Expect(checker.CheckCert("deploy", cert)).To(Succeed())
+		})
+	})
+
+	Context("when vault_addrs lists several servers", func() {
+		var (
+			sealed      *fakes.VaultServer
+			standby     *fakes.VaultServer
+			perfStandby *fakes.VaultServer
+		)
+
+		newServer := func(password string) *fakes.VaultServer {
+			s := fakes.NewVaultServer()
+			s.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+				"username": "atu",
+				"password": "0ld-p4ssw0rd",
+			})
+			s.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+				"username": "atu",
+				"password": password,
+			})
+			return s
+		}
+
+		vaultAddrUsed := func(session *gexec.Session) string {
+			var response models.Response
+			Expect(json.Unmarshal(session.Out.Contents(), &response)).To(Succeed())
+			for _, m := range response.Metadata {
+				if m.Key == "vault_addr" {
+					return m.Value
+				}
+			}
+			return ""
+		}
+
+		pathsRequested := func(s *fakes.VaultServer) []string {
+			var paths []string
+			for _, req := range s.Requests() {
+				paths = append(paths, req.Path)
+			}
+			return paths
+		}
+
+		BeforeEach(func() {
+			sealed = newServer("s34l3d-p4ssw0rd")
+			sealed.Seal()
+
+			standby = newServer("st4ndby-p4ssw0rd")
+			standby.Standby(false)
+
+			perfStandby = newServer("p3rf-p4ssw0rd")
+			perfStandby.Standby(true)
+
+			inRequest.Source.VaultAddr = ""
+			inRequest.Source.Retries = 1
+			inRequest.Source.MinBackoff = "10ms"
+			inRequest.Source.MaxBackoff = "10ms"
+		})
+
+		AfterEach(func() {
+			sealed.Close()
+			standby.Close()
+			perfStandby.Close()
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("and one is sealed", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultAddrs = []string{sealed.URL, standby.URL, server.URL}
+			})
+
+			It("reads from the active server and only probes the others", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(vaultAddrUsed(session)).To(Equal(server.URL))
+				Expect(pathsRequested(sealed)).To(Equal([]string{"sys/health"}))
+				Expect(pathsRequested(standby)).To(Equal([]string{"sys/health"}))
+				Expect(pathsRequested(server)).To(ContainElement("kv2/data/atu/foo"))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "n3w-p4ssw0rd"))
+			})
+		})
+
+		Context("and none is active", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultAddrs = []string{sealed.URL, standby.URL, perfStandby.URL}
+			})
+
+			It("prefers a performance standby to a standby", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(vaultAddrUsed(session)).To(Equal(perfStandby.URL))
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "p3rf-p4ssw0rd"))
+			})
+		})
+
+		Context("and the active server fails", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultAddrs = []string{sealed.URL, server.URL, standby.URL}
+				server.Fail("kv2/data/atu/foo", http.StatusServiceUnavailable)
+			})
+
+			It("fails over to the next healthy server", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(vaultAddrUsed(session)).To(Equal(standby.URL))
+				Expect(pathsRequested(sealed)).To(Equal([]string{"sys/health"}))
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "st4ndby-p4ssw0rd"))
+			})
+		})
+
+		Context("and every server is sealed", func() {
+			BeforeEach(func() {
+				server.Seal()
+				inRequest.Source.VaultAddrs = []string{sealed.URL, server.URL}
+			})
+
+			It("exits with error", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+				Expect(session.Err).To(gbytes.Say("no healthy vault address"))
+			})
+		})
+	})
+
+	Context("when requests are proxied", func() {
+		var (
+			proxy *fakes.Proxy
+			host  string
+		)
+
+		BeforeEach(func() {
+			proxy = fakes.NewProxy(server)
+
+			// requests to loopback addresses are never proxied, so vault is
+			// addressed by a name only the proxy can reach
+			host = "vault.example.test:8200"
+			inRequest.Source.VaultAddr = "http://" + host
+			inRequest.Source.Retries = 1
+			inRequest.Source.MinBackoff = "10ms"
+			inRequest.Source.MaxBackoff = "10ms"
+
+			command.Env = append(os.Environ(),
+				"HTTP_PROXY=", "HTTPS_PROXY=", "NO_PROXY=",
+				"http_proxy=", "https_proxy=", "no_proxy=",
+			)
+		})
+
+		AfterEach(func() {
+			proxy.Close()
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("through proxy_url", func() {
+			BeforeEach(func() {
+				inRequest.Source.ProxyURL = proxy.URL
+			})
+
+			It("sends every request through the proxy", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(proxy.Hosts()).NotTo(BeEmpty())
+				for _, h := range proxy.Hosts() {
+					Expect(h).To(Equal(host))
+				}
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "n3w-p4ssw0rd"))
+			})
+
+			Context("and the host is in no_proxy", func() {
+				BeforeEach(func() {
+					inRequest.Source.NoProxy = "localhost,.example.test"
+				})
+
+				It("connects directly", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					Expect(proxy.Hosts()).To(BeEmpty())
+					Expect(session.Err).To(gbytes.Say("vault.example.test"))
+				})
+			})
+		})
+
+		Context("through the HTTP_PROXY environment variable", func() {
+			BeforeEach(func() {
+				command.Env = append(command.Env, "HTTP_PROXY="+proxy.URL)
+			})
+
+			It("sends every request through the proxy", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(proxy.Hosts()).NotTo(BeEmpty())
+			})
+
+			Context("and no_proxy overrides NO_PROXY", func() {
+				BeforeEach(func() {
+					command.Env = append(command.Env, "NO_PROXY=other.example.test")
+					inRequest.Source.NoProxy = "vault.example.test"
+				})
+
+				It("connects directly", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+					Expect(proxy.Hosts()).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Context("when vault_addr is a unix socket", func() {
+		var (
+			agent     *fakes.VaultServer
+			socketDir string
+		)
+
+		BeforeEach(func() {
+			var err error
+			socketDir, err = ioutil.TempDir("", "vault-agent")
+			Expect(err).NotTo(HaveOccurred())
+
+			agent, err = fakes.NewUnixVaultServer(filepath.Join(socketDir, "agent.sock"))
+			Expect(err).NotTo(HaveOccurred())
+			agent.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+				"username": "atu",
+				"password": "4g3nt-p4ssw0rd",
+			})
+
+			inRequest.Source.VaultPaths = map[string]int{"kv2/data/atu/foo": 0}
+			inRequest.Source.VaultAddr = "unix://" + filepath.Join(socketDir, "agent.sock")
+			inRequest.Source.ProxyURL = "http://proxy.example.test:3128"
+		})
+
+		AfterEach(func() {
+			agent.Close()
+			os.RemoveAll(socketDir)
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("reads through the socket without a proxy", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			Expect(agent.Requests()).NotTo(BeEmpty())
+			secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+			Expect(secrets).To(HaveKeyWithValue("password", "4g3nt-p4ssw0rd"))
+		})
+
+		Context("in agent mode", func() {
+			BeforeEach(func() {
+				agent.UseAutoAuthToken()
+
+				inRequest.Source.Agent = true
+				inRequest.Source.VaultToken = ""
+				command.Env = append(os.Environ(), "VAULT_TOKEN=")
+			})
+
+			It("relies on the agent's token", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				By("Validating no token was sent or renewed")
+				for _, req := range agent.Requests() {
+					Expect(req.Header.Get("X-Vault-Token")).To(BeEmpty())
+					Expect(req.Path).NotTo(HavePrefix("auth/token/"))
+				}
+
+				secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+				Expect(secrets).To(HaveKeyWithValue("password", "4g3nt-p4ssw0rd"))
+			})
+		})
+
+		Context("with vault_addrs", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultAddrs = []string{vaultAddr}
+			})
+
+			It("exits with error", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+				Expect(session.Err).To(gbytes.Say("unix socket vault_addr cannot be combined with vault_addrs"))
+			})
+		})
+	})
+
+	Context("when agent is combined with vault_addrs", func() {
+		BeforeEach(func() {
+			inRequest.Source.Agent = true
+			inRequest.Source.VaultAddrs = []string{vaultAddr}
+
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+			Expect(session.Err).To(gbytes.Say("agent cannot be combined with vault_addrs"))
+		})
+	})
+
+	Context("when vault fails requests", func() {
+		requestsTo := func(p string) int {
+			n := 0
+			for _, req := range server.Requests() {
+				if req.Path == p {
+					n++
+				}
+			}
+			return n
+		}
+
+		BeforeEach(func() {
+			inRequest.Source.Retries = 2
+			inRequest.Source.MinBackoff = "10ms"
+			inRequest.Source.MaxBackoff = "50ms"
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("retries a retryable status until the request succeeds", func() {
+			server.FailTimes("kv2/data/atu/foo", http.StatusServiceUnavailable, 2)
+
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			Expect(requestsTo("kv2/data/atu/foo")).To(Equal(3))
+			secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+			Expect(secrets).To(HaveKeyWithValue("password", "n3w-p4ssw0rd"))
+		})
+
+		It("gives up once the retries are spent", func() {
+			server.Fail("kv2/data/atu/foo", http.StatusServiceUnavailable)
+
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+			Expect(requestsTo("kv2/data/atu/foo")).To(Equal(3))
+		})
+
+		It("retries a rate limited read until it succeeds", func() {
+			inRequest.Source.VaultPaths = map[string]int{
+				"kv2/data/atu/foo": 2,
+				"secret/atu/bar":   0,
+			}
+			stdin, err := json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+			server.FailTimes("secret/atu/bar", http.StatusTooManyRequests, 1)
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			Expect(requestsTo("secret/atu/bar")).To(Equal(2))
+			secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+			Expect(secrets).To(HaveKey("api-key"))
+		})
+
+		It("fails a rate limited read once the retries are spent", func() {
+			inRequest.Source.VaultPaths = map[string]int{
+				"secret/atu/bar": 0,
+			}
+			stdin, err := json.Marshal(inRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+			server.Fail("secret/atu/bar", http.StatusTooManyRequests)
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("Code: 429"))
+
+			Expect(requestsTo("secret/atu/bar")).To(Equal(3))
+			Expect(filepath.Join(destDirectory, "secrets")).NotTo(BeAnExistingFile())
+		})
+
+		It("does not retry a status which is not retryable", func() {
+			server.Fail("kv2/data/atu/foo", http.StatusForbidden)
+
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+
+			Expect(requestsTo("kv2/data/atu/foo")).To(Equal(1))
+		})
+
+		Context("with retryable_statuses", func() {
+			BeforeEach(func() {
+				inRequest.Source.RetryableStatuses = []int{http.StatusPreconditionFailed}
+			})
+
+			It("retries only the statuses listed", func() {
+				server.FailTimes("kv2/data/atu/foo", http.StatusPreconditionFailed, 1)
+
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+				Expect(requestsTo("kv2/data/atu/foo")).To(Equal(2))
+			})
+		})
+
+		Context("when vault is slower than request_timeout", func() {
+			BeforeEach(func() {
+				inRequest.Source.RequestTimeout = "100ms"
+				server.SetLatency(time.Minute)
+			})
+
+			It("times out each attempt and gives up once the retries are spent", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+				Expect(session.Err).To(gbytes.Say("deadline exceeded"))
+				Expect(server.Requests()).To(HaveLen(3))
+			})
+		})
+
+		Context("when vault is slower than the step timeout", func() {
+			BeforeEach(func() {
+				inRequest.Source.Timeout = "500ms"
+				server.SetLatency(time.Minute)
+			})
+
+			It("gives up at the deadline without retrying", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+				Expect(session.Err).To(gbytes.Say("deadline exceeded"))
+				Expect(server.Requests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the health of vault_addrs is probed", func() {
+			BeforeEach(func() {
+				inRequest.Source.VaultAddr = ""
+				inRequest.Source.VaultAddrs = []string{vaultAddr}
+				inRequest.Source.Timeout = "500ms"
+				server.SetLatency(time.Minute)
+			})
+
+			It("bounds the probes by the step timeout", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+				Expect(session.Err).To(gbytes.Say("no healthy vault address"))
+				Expect(server.Requests()[0].Path).To(Equal("sys/health"))
+			})
+		})
+	})
+
+	Context("when the secret does not exist", func() {
+		BeforeEach(func() {
+			server.Fail("kv2/data/atu/foo", 404)
+		})
+
+		It("writes no secrets", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, inTimeout).Should(gexec.Exit(0))
+
+			secrets := readSecrets(filepath.Join(destDirectory, "secrets"))
+			Expect(secrets).To(BeEmpty())
+		})
+	})
+
+	Context("when the pinned version is destroyed", func() {
+		BeforeEach(func() {
+			server.DestroyKV2Version("kv2/data/atu/foo", 2)
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("version 2 has been destroyed"))
+		})
+	})
+
+	Context("when the pinned version is deleted", func() {
+		BeforeEach(func() {
+			server.DeleteKV2Version("kv2/data/atu/foo", 2)
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, inTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("version 2 was deleted at"))
+		})
 	})
 
 	Context("when validation fails", func() {
@@ -104,3 +1847,13 @@ var _ = Describe("In", func() {
 		})
 	})
 })
+
+func readSecrets(p string) map[string]interface{} {
+	b, err := ioutil.ReadFile(p)
+	Expect(err).NotTo(HaveOccurred())
+
+	secrets := make(map[string]interface{}, 0)
+	Expect(json.Unmarshal(b, &secrets)).To(Succeed())
+
+	return secrets
+}
@@ -0,0 +1,1029 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
+	"github.com/comcast/concourse-vault-resource/test/fakes"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+const (
+	outTimeout = 40 * time.Second
+)
+
+var _ = Describe("Out", func() {
+	var (
+		command       *exec.Cmd
+		outRequest    models.Request
+		stdinContents []byte
+		srcDirectory  string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		By("Creating temp directory")
+		srcDirectory, err = ioutil.TempDir("", "concourse-vault-resource")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating command object")
+		command = exec.Command(outPath, srcDirectory)
+
+		By("Creating default request")
+		outRequest = models.Request{
+			Source: models.Source{
+				VaultAddr:  vaultAddr,
+				VaultToken: vaultToken,
+			},
+			Params: models.Params{
+				RevokeLeasesFrom: "vault",
+			},
+		}
+
+		stdinContents, err = json.Marshal(outRequest)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("when no lease manifest exists", func() {
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, outTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("error reading lease manifest"))
+		})
+	})
+
+	Context("when revoking the leases of a get step", func() {
+		BeforeEach(func() {
+			By("Reading a dynamic secret into the get step's directory")
+			getDirectory := filepath.Join(srcDirectory, "vault")
+			Expect(os.Mkdir(getDirectory, 0700)).To(Succeed())
+
+			get := exec.Command(inPath, getDirectory)
+			stdin, err := json.Marshal(models.Request{
+				Source: models.Source{
+					VaultPaths: map[string]int{
+						"database/creds/readonly": 0,
+					},
+					VaultAddr:  vaultAddr,
+					VaultToken: vaultToken,
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(run(get, stdin), outTimeout).Should(gexec.Exit(0))
+		})
+
+		It("revokes every lease", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			response := models.Response{}
+			err := json.Unmarshal(session.Out.Contents(), &response)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.Version.Path).To(Equal("sys/leases/revoke"))
+
+			var revoked int
+			for _, m := range response.Metadata {
+				if l, ok := server.Lease(m.Key); ok {
+					Expect(l.Revoked).To(BeTrue())
+					revoked++
+				}
+			}
+			Expect(revoked).To(Equal(1))
+		})
+	})
+
+	Context("when renewing the leases of a get step", func() {
+		BeforeEach(func() {
+			By("Reading a dynamic secret into the get step's directory")
+			getDirectory := filepath.Join(srcDirectory, "vault")
+			Expect(os.Mkdir(getDirectory, 0700)).To(Succeed())
+
+			get := exec.Command(inPath, getDirectory)
+			stdin, err := json.Marshal(models.Request{
+				Source: models.Source{
+					VaultPaths: map[string]int{
+						"database/creds/readonly": 0,
+					},
+					VaultAddr:  vaultAddr,
+					VaultToken: vaultToken,
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(run(get, stdin), outTimeout).Should(gexec.Exit(0))
+
+			outRequest.Params = models.Params{
+				RenewLeasesFrom: "vault",
+				Increment:       600,
+			}
+			stdinContents, err = json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("renews every lease by the increment", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			response := models.Response{}
+			err := json.Unmarshal(session.Out.Contents(), &response)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.Version.Path).To(Equal("sys/leases/renew"))
+
+			var renewed int
+			for _, m := range response.Metadata {
+				if l, ok := server.Lease(m.Key); ok {
+					Expect(m.Value).To(Equal("renewed ttl=3600s"))
+					Expect(l.Renewals).To(Equal(1))
+					Expect(l.Revoked).To(BeFalse())
+					renewed++
+				}
+			}
+			Expect(renewed).To(Equal(1))
+
+			var renewals []fakes.Request
+			for _, req := range server.Requests() {
+				if req.Path == "sys/leases/renew" {
+					renewals = append(renewals, req)
+				}
+			}
+			Expect(renewals).To(HaveLen(1))
+			Expect(renewals[0].Body).To(HaveKeyWithValue("increment", float64(600)))
+		})
+
+		Context("and a lease has been revoked since", func() {
+			BeforeEach(func() {
+				By("Revoking the leases of the get step")
+				revoke, err := json.Marshal(models.Request{
+					Source: outRequest.Source,
+					Params: models.Params{
+						RevokeLeasesFrom: "vault",
+					},
+				})
+				Expect(err).ShouldNot(HaveOccurred())
+				Eventually(run(exec.Command(outPath, srcDirectory), revoke), outTimeout).Should(gexec.Exit(0))
+			})
+
+			It("exits with an error reporting the failed renewal", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("error renewing lease"))
+				Expect(session.Err).Should(gbytes.Say(`1 of 1 lease\(s\) could not be renewed`))
+			})
+		})
+	})
+
+	Context("when writing a kv2 secret", func() {
+		BeforeEach(func() {
+			outRequest.Params = models.Params{
+				Path: "kv2/data/atu/foo",
+				Data: map[string]interface{}{
+					"username": "svc-deploy",
+					"password": "r0t4t3d-p4ssw0rd",
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			stdinContents, err = json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("writes a new version", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			response := models.Response{}
+			err := json.Unmarshal(session.Out.Contents(), &response)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(response.Version).To(Equal(models.Version{
+				Path:    "kv2/data/atu/foo",
+				Version: "3",
+			}))
+			Expect(server.ReadKV2("kv2/data/atu/foo", 3)).To(
+				HaveKeyWithValue("password", "r0t4t3d-p4ssw0rd"),
+			)
+
+			By("Validating the value is never logged")
+			Expect(session.Err.Contents()).NotTo(ContainSubstring("r0t4t3d-p4ssw0rd"))
+		})
+
+		Context("with child_token", func() {
+			BeforeEach(func() {
+				outRequest.Source.ChildToken = true
+			})
+
+			It("writes with a child token and revokes it", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+				tokens := server.Tokens()
+				Expect(tokens).To(HaveLen(1))
+				Expect(tokens[0].Revoked).To(BeTrue())
+
+				for _, req := range server.Requests() {
+					if req.Path == "kv2/data/atu/foo" && req.Method == "PUT" {
+						Expect(req.Header.Get("X-Vault-Token")).To(Equal(tokens[0].Token))
+					}
+				}
+			})
+		})
+
+		Context("and vault echoes the data in an error", func() {
+			BeforeEach(func() {
+				outRequest.Params.Data = map[string]interface{}{
+					"password": "r0t4t3d-p4ssw0rd",
+					"port":     5432,
+					"enabled":  true,
+					"ttl":      "1h",
+				}
+				server.Fail("kv2/data/atu/foo", http.StatusBadRequest)
+			})
+
+			It("redacts only the secret values", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+
+				stderr := string(session.Err.Contents())
+				Expect(stderr).To(ContainSubstring("request body"))
+				Expect(stderr).NotTo(ContainSubstring("r0t4t3d-p4ssw0rd"))
+				Expect(stderr).To(ContainSubstring(`\"password\":\"[redacted]\"`))
+				Expect(stderr).To(ContainSubstring(`\"port\":5432`))
+				Expect(stderr).To(ContainSubstring(`\"enabled\":true`))
+				Expect(stderr).To(ContainSubstring(`\"ttl\":\"1h\"`))
+				Expect(stderr).To(ContainSubstring("kv2/data/atu/foo"))
+			})
+		})
+
+		Context("from a data_file", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(
+					filepath.Join(srcDirectory, "secret.yml"),
+					[]byte("db:\n  password: f1l3-p4ssw0rd\n"),
+					0600,
+				)).To(Succeed())
+
+				outRequest.Params.Data = nil
+				outRequest.Params.DataFile = "secret.yml"
+			})
+
+			It("writes the file's data", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+				Expect(server.ReadKV2("kv2/data/atu/foo", 3)).To(Equal(map[string]interface{}{
+					"db": map[string]interface{}{"password": "f1l3-p4ssw0rd"},
+				}))
+			})
+		})
+
+		Context("with method patch", func() {
+			BeforeEach(func() {
+				outRequest.Params.Method = "patch"
+				outRequest.Params.Data = map[string]interface{}{
+					"password": "p4tch3d-p4ssw0rd",
+					"username": nil,
+					"region":   "us-east-1",
+				}
+			})
+
+			It("merges the data into the secret and reports the keys changed", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+				Expect(server.ReadKV2("kv2/data/atu/foo", 3)).To(Equal(map[string]interface{}{
+					"password": "p4tch3d-p4ssw0rd",
+					"region":   "us-east-1",
+				}))
+
+				response := models.Response{}
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+					Key: "changed", Value: "password,region",
+				}))
+				Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+					Key: "removed", Value: "username",
+				}))
+
+				var methods []string
+				for _, req := range server.Requests() {
+					if req.Path == "kv2/data/atu/foo" {
+						methods = append(methods, req.Method)
+					}
+				}
+				Expect(methods).To(ContainElement("PATCH"))
+				Expect(methods).NotTo(ContainElement("PUT"))
+			})
+
+			Context("and vault cannot patch", func() {
+				BeforeEach(func() {
+					server.DisablePatch()
+				})
+
+				It("writes the merged data with a cas of the version read", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+					Expect(server.ReadKV2("kv2/data/atu/foo", 3)).To(Equal(map[string]interface{}{
+						"password": "p4tch3d-p4ssw0rd",
+						"region":   "us-east-1",
+					}))
+
+					var writes []fakes.Request
+					for _, req := range server.Requests() {
+						if req.Path == "kv2/data/atu/foo" && req.Method == "PUT" {
+							writes = append(writes, req)
+						}
+					}
+					Expect(writes).To(HaveLen(1))
+					Expect(writes[0].Body).To(HaveKeyWithValue("options", map[string]interface{}{
+						"cas": float64(2),
+					}))
+				})
+
+				Context("and vault echoes the merged data in an error", func() {
+					BeforeEach(func() {
+						outRequest.Params.Data = map[string]interface{}{
+							"region": "us-east-1",
+						}
+						server.FailWrites("kv2/data/atu/foo", http.StatusBadRequest)
+					})
+
+					It("redacts the values it kept", func() {
+						By("Running the command")
+						session := run(command, stdinContents)
+						Eventually(session, outTimeout).Should(gexec.Exit(1))
+
+						stderr := string(session.Err.Contents())
+						Expect(stderr).To(ContainSubstring("request body"))
+						Expect(stderr).NotTo(ContainSubstring("n3w-p4ssw0rd"))
+						Expect(stderr).To(ContainSubstring(`\"password\":\"[redacted]\"`))
+					})
+				})
+			})
+
+			Context("and the secret does not exist", func() {
+				BeforeEach(func() {
+					outRequest.Params.Path = "kv2/data/atu/missing"
+				})
+
+				It("exits with error", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, outTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("only existing secrets can be patched"))
+				})
+			})
+		})
+
+		Context("with a cas matching the current version", func() {
+			BeforeEach(func() {
+				outRequest.Params.CAS = "2"
+			})
+
+			It("writes a new version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+				Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(3))
+			})
+		})
+
+		Context("with a cas behind the current version", func() {
+			BeforeEach(func() {
+				outRequest.Params.CAS = "1"
+			})
+
+			It("exits with a conflict showing both versions", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say(
+					"check-and-set conflict writing kv2/data/atu/foo: expected version 1 but the current version is 2",
+				))
+				Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(2))
+			})
+		})
+
+		Context("with a cas of 0 for a secret which exists", func() {
+			BeforeEach(func() {
+				outRequest.Params.CAS = "0"
+			})
+
+			It("exits with a conflict", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("expected version 0 but the current version is 2"))
+			})
+		})
+
+		Context("with a cas from the version read by a get step", func() {
+			BeforeEach(func() {
+				By("Reading the secret into the get step's directory")
+				getDirectory := filepath.Join(srcDirectory, "vault")
+				Expect(os.Mkdir(getDirectory, 0700)).To(Succeed())
+
+				get := exec.Command(inPath, getDirectory)
+				stdin, err := json.Marshal(models.Request{
+					Source: models.Source{
+						VaultPaths: map[string]int{
+							"kv2/data/atu/foo": -1,
+						},
+						VaultAddr:  vaultAddr,
+						VaultToken: vaultToken,
+					},
+					Params: models.Params{
+						WriteVersions: true,
+					},
+				})
+				Expect(err).ShouldNot(HaveOccurred())
+				Eventually(run(get, stdin), outTimeout).Should(gexec.Exit(0))
+
+				outRequest.Params.CAS = "from_input"
+				outRequest.Params.VersionsFrom = "vault"
+			})
+
+			It("writes a new version", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+				Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(3))
+			})
+
+			Context("and the secret changed since", func() {
+				BeforeEach(func() {
+					server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+						"password": "c0nc4rr3nt-p4ssw0rd",
+					})
+				})
+
+				It("exits with a conflict", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, outTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("expected version 2 but the current version is 3"))
+				})
+			})
+		})
+
+		Context("with a cas from a get step which did not write versions", func() {
+			BeforeEach(func() {
+				Expect(os.Mkdir(filepath.Join(srcDirectory, "vault"), 0700)).To(Succeed())
+
+				outRequest.Params.CAS = "from_input"
+				outRequest.Params.VersionsFrom = "vault"
+			})
+
+			It("exits asking for write_versions", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("set write_versions on the get step"))
+				Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(2))
+			})
+		})
+
+		Context("with a generated value", func() {
+			BeforeEach(func() {
+				outRequest.Params.Method = "patch"
+				outRequest.Params.Data = nil
+				outRequest.Params.Generate = models.Generate{
+					Key:       "password",
+					Length:    24,
+					MinDigits: 4,
+				}
+			})
+
+			It("writes the value to the key without printing it", func() {
+				By("Running the command")
+				session := run(command, stdinContents)
+				Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+				secret := server.ReadKV2("kv2/data/atu/foo", 3)
+				Expect(secret).To(HaveKeyWithValue("username", "atu"))
+
+				password, ok := secret["password"].(string)
+				Expect(ok).To(BeTrue())
+				Expect(password).To(MatchRegexp(`^[a-zA-Z0-9]{24}$`))
+				Expect(password).NotTo(Equal("n3w-p4ssw0rd"))
+
+				digits := 0
+				for _, c := range password {
+					if c >= '0' && c <= '9' {
+						digits++
+					}
+				}
+				Expect(digits).To(BeNumerically(">=", 4))
+
+				response := models.Response{}
+				err := json.Unmarshal(session.Out.Contents(), &response)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+					Key: "generated", Value: "password",
+				}))
+
+				By("Validating the value is never printed")
+				Expect(session.Out.Contents()).NotTo(ContainSubstring(password))
+				Expect(session.Err.Contents()).NotTo(ContainSubstring(password))
+			})
+
+			Context("from a password policy", func() {
+				BeforeEach(func() {
+					server.AddPasswordPolicy("rotation")
+					outRequest.Params.Generate = models.Generate{
+						Key:    "password",
+						Policy: "rotation",
+					}
+				})
+
+				It("writes the value the policy generated", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+					password, _ := server.ReadKV2("kv2/data/atu/foo", 3)["password"].(string)
+					Expect(password).To(HavePrefix("rotation-"))
+					Expect(session.Err.Contents()).NotTo(ContainSubstring(password))
+				})
+			})
+
+			Context("whose minimums exceed its length", func() {
+				BeforeEach(func() {
+					outRequest.Params.Generate.Length = 3
+				})
+
+				It("exits with error", func() {
+					By("Running the command")
+					session := run(command, stdinContents)
+					Eventually(session, outTimeout).Should(gexec.Exit(1))
+					Expect(session.Err).Should(gbytes.Say("more than generate.length 3"))
+				})
+			})
+		})
+	})
+
+	Context("when rolling back a kv2 secret", func() {
+		var response models.Response
+
+		runOut := func(code int) *gexec.Session {
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(code))
+
+			if code == 0 {
+				response = models.Response{}
+				Expect(json.Unmarshal(session.Out.Contents(), &response)).To(Succeed())
+			}
+			return session
+		}
+
+		BeforeEach(func() {
+			outRequest.Params = models.Params{
+				Path:       "kv2/data/atu/foo",
+				RollbackTo: "previous",
+			}
+		})
+
+		It("writes the previous version as a new version", func() {
+			runOut(0)
+
+			Expect(response.Version).To(Equal(models.Version{
+				Path:    "kv2/data/atu/foo",
+				Version: "3",
+			}))
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "rolled_back_to", Value: "1",
+			}))
+			Expect(server.ReadKV2("kv2/data/atu/foo", 3)).To(
+				Equal(server.ReadKV2("kv2/data/atu/foo", 1)),
+			)
+
+			By("Validating the write is checked against the current version")
+			var cas []interface{}
+			for _, req := range server.Requests() {
+				if req.Path == "kv2/data/atu/foo" && req.Method == "PUT" {
+					options, _ := req.Body["options"].(map[string]interface{})
+					cas = append(cas, options["cas"])
+				}
+			}
+			Expect(cas).To(Equal([]interface{}{float64(2)}))
+		})
+
+		It("skips deleted versions when rolling back to the previous version", func() {
+			server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+				"password": "b4d-p4ssw0rd",
+			})
+			server.DeleteKV2Version("kv2/data/atu/foo", 2)
+
+			runOut(0)
+
+			Expect(response.Version.Version).To(Equal("4"))
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "rolled_back_to", Value: "1",
+			}))
+			Expect(server.ReadKV2("kv2/data/atu/foo", 4)).To(
+				HaveKeyWithValue("password", "0ld-p4ssw0rd"),
+			)
+		})
+
+		It("rolls back to a version number", func() {
+			server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+				"password": "b4d-p4ssw0rd",
+			})
+			outRequest.Params.RollbackTo = "1"
+
+			runOut(0)
+
+			Expect(response.Version.Version).To(Equal("4"))
+			Expect(server.ReadKV2("kv2/data/atu/foo", 4)).To(
+				HaveKeyWithValue("password", "0ld-p4ssw0rd"),
+			)
+		})
+
+		It("exits with error when the version cannot be read", func() {
+			server.DestroyKV2Version("kv2/data/atu/foo", 1)
+			outRequest.Params.RollbackTo = "1"
+
+			session := runOut(1)
+			Expect(session.Err).Should(gbytes.Say("version 1 has been destroyed"))
+			Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(2))
+		})
+
+		It("exits with a conflict when the cas does not match", func() {
+			outRequest.Params.CAS = "1"
+
+			session := runOut(1)
+			Expect(session.Err).Should(gbytes.Say("expected version 1 but the current version is 2"))
+		})
+	})
+
+	Context("when signing a public key", func() {
+		var publicKey ssh.PublicKey
+
+		BeforeEach(func() {
+			pub, _, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			publicKey, err = ssh.NewPublicKey(pub)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(srcDirectory, "keys"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(
+				filepath.Join(srcDirectory, "keys", "id_ed25519.pub"),
+				ssh.MarshalAuthorizedKey(publicKey), 0644,
+			)).To(Succeed())
+
+			outRequest.Source.SSH = models.SSH{
+				Role:       "deploy",
+				Principals: []string{"deploy", "ops"},
+				TTL:        "30m",
+			}
+			outRequest.Params = models.Params{
+				SSH: models.SSHParams{PublicKey: "keys/id_ed25519.pub"},
+			}
+		})
+
+		It("writes the certificate next to the public key", func() {
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			b, err := ioutil.ReadFile(filepath.Join(srcDirectory, "keys", "id_ed25519-cert.pub"))
+			Expect(err).NotTo(HaveOccurred())
+			key, _, _, _, err := ssh.ParseAuthorizedKey(b)
+			Expect(err).NotTo(HaveOccurred())
+			cert, ok := key.(*ssh.Certificate)
+			Expect(ok).To(BeTrue())
+
+			Expect(cert.Key.Marshal()).To(Equal(publicKey.Marshal()))
+			Expect(cert.ValidPrincipals).To(Equal([]string{"deploy", "ops"}))
+			Expect(cert.SignatureKey.Marshal()).To(Equal(server.SSHCA().Marshal()))
+
+			response := models.Response{}
+			Expect(json.Unmarshal(session.Out.Contents(), &response)).To(Succeed())
+			Expect(response.Version.Path).To(Equal("ssh/sign/deploy"))
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "certificate", Value: "keys/id_ed25519-cert.pub",
+			}))
+		})
+	})
+
+	Context("when encrypting files with transit", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(srcDirectory, "config"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(
+				filepath.Join(srcDirectory, "config", "app.yml"), []byte("token: t0k3n\n"), 0600,
+			)).To(Succeed())
+
+			outRequest.Params = models.Params{
+				Transit: models.TransitParams{
+					Transit:     models.Transit{Key: "deploy"},
+					Action:      "encrypt",
+					Files:       []string{"config/*.yml"},
+					Destination: "encrypted",
+				},
+			}
+		})
+
+		It("writes the ciphertext to the destination", func() {
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			b, err := ioutil.ReadFile(filepath.Join(srcDirectory, "encrypted", "app.yml.vault"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(HavePrefix("vault:v1:"))
+		})
+	})
+
+	Context("when decrypting files with transit", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(srcDirectory, "encrypted"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(
+				filepath.Join(srcDirectory, "encrypted", "app.yml.vault"),
+				[]byte(fakes.Ciphertext("token: t0k3n-s3cr3t\n")+"\n"), 0600,
+			)).To(Succeed())
+
+			outRequest.Params = models.Params{
+				Transit: models.TransitParams{
+					Transit:     models.Transit{Key: "deploy"},
+					Action:      "decrypt",
+					Files:       []string{"encrypted/*.vault"},
+					Destination: "config",
+				},
+			}
+		})
+
+		It("writes the plaintext to the destination without the extension", func() {
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(0))
+
+			b, err := ioutil.ReadFile(filepath.Join(srcDirectory, "config", "app.yml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("token: t0k3n-s3cr3t\n"))
+
+			response := models.Response{}
+			Expect(json.Unmarshal(session.Out.Contents(), &response)).To(Succeed())
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "encrypted/app.yml.vault", Value: "config/app.yml",
+			}))
+			Expect(string(session.Err.Contents())).NotTo(ContainSubstring("t0k3n-s3cr3t"))
+		})
+
+		Context("and a file is not ciphertext", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(
+					filepath.Join(srcDirectory, "encrypted", "app.yml.vault"), []byte("token: t0k3n\n"), 0600,
+				)).To(Succeed())
+			})
+
+			It("exits naming the file", func() {
+				stdin, err := json.Marshal(outRequest)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				By("Running the command")
+				session := run(command, stdin)
+				Eventually(session, outTimeout).Should(gexec.Exit(1))
+				Expect(session.Err).Should(gbytes.Say("error decrypting encrypted/app.yml.vault"))
+				Expect(filepath.Join(srcDirectory, "config", "app.yml")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Context("when params name files outside the build directory", func() {
+		outside := func(params models.Params, message string) {
+			outRequest.Params = params
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say(message))
+		}
+
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(
+				filepath.Join(srcDirectory, "app.yml"), []byte("token: t0k3n\n"), 0600,
+			)).To(Succeed())
+		})
+
+		It("rejects a data_file which leaves the build directory", func() {
+			outside(models.Params{
+				Path:     "kv2/data/atu/foo",
+				DataFile: "../secret.yml",
+			}, "../secret.yml is outside the build directory")
+		})
+
+		It("rejects an absolute data_file", func() {
+			outside(models.Params{
+				Path:     "kv2/data/atu/foo",
+				DataFile: "/etc/hosts",
+			}, "/etc/hosts must be relative to the build directory")
+		})
+
+		It("rejects transit.files which leave the build directory", func() {
+			outside(models.Params{
+				Transit: models.TransitParams{
+					Transit: models.Transit{Key: "deploy"},
+					Action:  "encrypt",
+					Files:   []string{"../*/*.yml"},
+				},
+			}, "is outside the build directory")
+		})
+
+		It("rejects a transit.destination which leaves the build directory", func() {
+			outside(models.Params{
+				Transit: models.TransitParams{
+					Transit:     models.Transit{Key: "deploy"},
+					Action:      "encrypt",
+					Files:       []string{"app.yml"},
+					Destination: "sub/../../escaped",
+				},
+			}, "sub/../../escaped is outside the build directory")
+			Expect(filepath.Join(filepath.Dir(srcDirectory), "escaped")).NotTo(BeADirectory())
+		})
+
+		It("rejects an ssh.public_key outside the build directory", func() {
+			outRequest.Source.SSH = models.SSH{Role: "deploy", TTL: "1h"}
+			outside(models.Params{
+				SSH: models.SSHParams{PublicKey: "/root/.ssh/id_rsa.pub"},
+			}, "must be relative to the build directory")
+		})
+
+		It("rejects a lease manifest outside the build directory", func() {
+			outside(models.Params{
+				RevokeLeasesFrom: "../vault",
+			}, "../vault/leases is outside the build directory")
+		})
+	})
+
+	Context("when removing a secret", func() {
+		var response models.Response
+
+		runOut := func(code int) *gexec.Session {
+			stdin, err := json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			By("Running the command")
+			session := run(command, stdin)
+			Eventually(session, outTimeout).Should(gexec.Exit(code))
+
+			if code == 0 {
+				response = models.Response{}
+				err = json.Unmarshal(session.Out.Contents(), &response)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+
+			return session
+		}
+
+		BeforeEach(func() {
+			outRequest.Params = models.Params{
+				Path:    "kv2/data/atu/foo",
+				Action:  "delete",
+				Confirm: true,
+			}
+		})
+
+		It("deletes the current version", func() {
+			runOut(0)
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "versions", Value: "2",
+			}))
+
+			deleted, _ := server.VersionState("kv2/data/atu/foo", 2)
+			Expect(deleted).To(BeTrue())
+			deleted, _ = server.VersionState("kv2/data/atu/foo", 1)
+			Expect(deleted).To(BeFalse())
+		})
+
+		It("deletes specific versions", func() {
+			outRequest.Params.Versions = []int{1}
+			runOut(0)
+
+			deleted, _ := server.VersionState("kv2/data/atu/foo", 1)
+			Expect(deleted).To(BeTrue())
+			deleted, _ = server.VersionState("kv2/data/atu/foo", 2)
+			Expect(deleted).To(BeFalse())
+		})
+
+		It("undeletes versions", func() {
+			server.DeleteKV2Version("kv2/data/atu/foo", 2)
+			outRequest.Params.Action = "undelete"
+			outRequest.Params.Versions = []int{2}
+			runOut(0)
+
+			deleted, _ := server.VersionState("kv2/data/atu/foo", 2)
+			Expect(deleted).To(BeFalse())
+		})
+
+		It("destroys versions", func() {
+			outRequest.Params.Action = "destroy"
+			outRequest.Params.Versions = []int{1}
+			runOut(0)
+
+			_, destroyed := server.VersionState("kv2/data/atu/foo", 1)
+			Expect(destroyed).To(BeTrue())
+		})
+
+		It("deletes the metadata and every version", func() {
+			outRequest.Params.Action = "delete_metadata"
+			runOut(0)
+
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "versions", Value: "1,2",
+			}))
+			Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(0))
+		})
+
+		It("deletes kv1 secrets", func() {
+			outRequest.Params.Path = "secret/atu/bar"
+			runOut(0)
+
+			Expect(server.ReadKV1("secret/atu/bar")).To(BeNil())
+		})
+
+		It("reports what a dry run would remove without removing it", func() {
+			outRequest.Params.Action = "delete_metadata"
+			outRequest.Params.Confirm = false
+			outRequest.Params.DryRun = true
+			runOut(0)
+
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "versions", Value: "1,2",
+			}))
+			Expect(response.Metadata).To(ContainElement(models.MetadataKvP{
+				Key: "dry_run", Value: "true",
+			}))
+			Expect(server.CurrentVersion("kv2/data/atu/foo")).To(Equal(2))
+		})
+
+		It("exits with error when not confirmed", func() {
+			outRequest.Params.Confirm = false
+			session := runOut(1)
+
+			Expect(session.Err).Should(gbytes.Say("confirm must be set to true to delete kv2/data/atu/foo"))
+			deleted, _ := server.VersionState("kv2/data/atu/foo", 2)
+			Expect(deleted).To(BeFalse())
+		})
+	})
+
+	Context("when validation fails", func() {
+		BeforeEach(func() {
+			outRequest.Params = models.Params{}
+
+			var err error
+			stdinContents, err = json.Marshal(outRequest)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("exits with error", func() {
+			By("Running the command")
+			session := run(command, stdinContents)
+
+			By("Validating command exited with error")
+			Eventually(session, outTimeout).Should(gexec.Exit(1))
+			Expect(session.Err).Should(gbytes.Say("error validating resource configuration"))
+		})
+	})
+})
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource"
+)
+
+var _ = Describe("Redactor", func() {
+	var (
+		buf      *bytes.Buffer
+		redactor *resource.Redactor
+		logger   zerolog.Logger
+		secrets  []string
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		redactor = resource.NewRedactor(buf)
+		logger = zerolog.New(redactor)
+		secrets = []string{
+			"s3cr3t-p@ssw0rd",
+			"s.faKev4ultT0k3n",
+			"line one\nline \"two\"",
+		}
+		redactor.Add(secrets...)
+	})
+
+	It("redacts secret values from log messages and fields", func() {
+		logger.Info().Str("value", secrets[0]).Msgf("token is %s", secrets[1])
+
+		Expect(buf.String()).NotTo(BeEmpty())
+		for _, s := range secrets[:2] {
+			Expect(buf.String()).NotTo(ContainSubstring(s))
+		}
+		Expect(buf.String()).To(ContainSubstring("[redacted]"))
+	})
+
+	It("redacts secret values echoed in errors", func() {
+		err := errors.New(`Error making API request. Code: 400. Errors: * invalid request body {"password":"s3cr3t-p@ssw0rd"}`)
+		logger.Error().Err(err).Msg("error writing secret")
+
+		Expect(buf.String()).NotTo(ContainSubstring(secrets[0]))
+		Expect(buf.String()).To(ContainSubstring("error writing secret"))
+	})
+
+	It("redacts values as they are escaped in json", func() {
+		logger.Info().Str("value", secrets[2]).Msg("multi-line value")
+
+		b, err := json.Marshal(secrets[2])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).NotTo(ContainSubstring(string(b[1 : len(b)-1])))
+	})
+
+	It("redacts nested values added from a secret", func() {
+		redactor.AddValue(map[string]interface{}{
+			"db": map[string]interface{}{
+				"hosts": []interface{}{"db-primary.internal"},
+				"pin":   json.Number("40961024"),
+			},
+		})
+
+		Expect(redactor.Redact("db-primary.internal 40961024")).To(Equal("[redacted] [redacted]"))
+	})
+
+	It("does not redact short strings, small numbers or bools added from a secret", func() {
+		redactor.AddValue(map[string]interface{}{
+			"region":   "eu",
+			"port":     json.Number("5432"),
+			"ttl":      float64(3600),
+			"replicas": 3,
+			"enabled":  true,
+		})
+
+		line := "region=eu port=5432 ttl=3600s replicas=3 enabled=true"
+		Expect(redactor.Redact(line)).To(Equal(line))
+	})
+
+	It("redacts the longest matching value", func() {
+		redactor.Add("s3cr3t")
+
+		Expect(redactor.Redact(secrets[0])).To(Equal("[redacted]"))
+	})
+})
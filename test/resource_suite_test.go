@@ -3,19 +3,21 @@ package test
 import (
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/comcast/concourse-vault-resource/test/fakes"
 	"github.com/onsi/gomega/gexec"
 )
 
 var (
 	checkPath  string
 	inPath     string
+	outPath    string
+	server     *fakes.VaultServer
 	vaultAddr  string
 	vaultToken string
 )
@@ -28,14 +30,6 @@ func TestResource(t *testing.T) {
 var _ = BeforeSuite(func() {
 	var err error
 
-	By("Getting VAULT_ADDR from environment variables")
-	vaultAddr = os.Getenv("VAULT_ADDR")
-	Expect(vaultAddr).NotTo(BeEmpty(), "$VAULT_ADDR must be provided")
-
-	By("Getting VAULT_TOKEN from environment variables")
-	vaultToken = os.Getenv("VAULT_TOKEN")
-	Expect(vaultAddr).NotTo(BeEmpty(), "$VAULT_TOKEN must be provided")
-
 	By("Compiling check binary")
 	checkPath, err = gexec.Build("github.com/comcast/concourse-vault-resource/cmd/check", "-race")
 	Expect(err).NotTo(HaveOccurred())
@@ -43,6 +37,34 @@ var _ = BeforeSuite(func() {
 	By("Compiling in binary")
 	inPath, err = gexec.Build("github.com/comcast/concourse-vault-resource/cmd/in", "-race")
 	Expect(err).NotTo(HaveOccurred())
+
+	By("Compiling out binary")
+	outPath, err = gexec.Build("github.com/comcast/concourse-vault-resource/cmd/out", "-race")
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = BeforeEach(func() {
+	By("Starting a fake vault server")
+	server = fakes.NewVaultServer()
+	vaultAddr = server.URL
+	vaultToken = fakes.RootToken
+
+	By("Seeding the fake vault server with secrets")
+	server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+		"username": "atu",
+		"password": "0ld-p4ssw0rd",
+	})
+	server.WriteKV2("kv2/data/atu/foo", map[string]interface{}{
+		"username": "atu",
+		"password": "n3w-p4ssw0rd",
+	})
+	server.WriteKV1("secret/atu/bar", map[string]interface{}{
+		"api-key": "k3y",
+	})
+})
+
+var _ = AfterEach(func() {
+	server.Close()
 })
 
 var _ = AfterSuite(func() {
@@ -1,29 +1,58 @@
 package test
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/hashicorp/vault/api"
+	"github.com/rs/zerolog"
+
+	"github.com/comcast/concourse-vault-resource/pkg/resource"
 	"github.com/comcast/concourse-vault-resource/pkg/resource/models"
 	"github.com/comcast/concourse-vault-resource/test/fakes"
 )
 
 var _ = Describe("Vault", func() {
 	var (
-		check   []models.Version
-		err     error
+		logical *fakes.FakeLogical
 		request models.Request
-		stdin   *bytes.Buffer
-		v       *fakes.FakeVault
+		workDir string
 	)
 
+	newResource := func() *resource.Resource {
+		redactor := resource.NewRedactor(GinkgoWriter)
+		logger := zerolog.New(redactor)
+
+		r, err := resource.New(workDir, request, logger,
+			resource.WithRedactor(redactor),
+			resource.WithLogical(logical),
+		)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		return r
+	}
+
 	BeforeEach(func() {
-		v = new(fakes.FakeVault)
-		check = make([]models.Version, 0)
-		stdin = &bytes.Buffer{}
+		var err error
+		workDir, err = ioutil.TempDir("", "concourse-vault-resource")
+		Expect(err).NotTo(HaveOccurred())
+
+		logical = new(fakes.FakeLogical)
+		logical.WriteStub = func(p string, data map[string]interface{}) (*api.Secret, error) {
+			if p == "auth/token/renew-self" {
+				return &api.Secret{
+					Auth: &api.SecretAuth{ClientToken: "faKev4ultT0k3n"},
+				}, nil
+			}
+			return nil, nil
+		}
+
 		request = models.Request{
 			Source: models.Source{
 				VaultPaths: map[string]int{
@@ -33,35 +62,236 @@ var _ = Describe("Vault", func() {
 				VaultToken: "faKev4ultT0k3n",
 			},
 		}
+	})
 
-		err = json.NewEncoder(stdin).Encode(request)
-		Expect(err).ShouldNot(HaveOccurred())
+	AfterEach(func() {
+		os.RemoveAll(workDir)
 	})
 
 	Describe("when Check() is called", func() {
 		Context("checks the resource for versions and a version is found", func() {
-			It("should return []models.Version containing a new version", func() {
-				check = append(check, models.Version{
-					Version: "1",
-				})
-				v.CheckReturns(check)
-				Expect(v.Check()).To(Equal(check))
+			BeforeEach(func() {
+				logical.ReadStub = func(p string) (*api.Secret, error) {
+					switch p {
+					case "sys/internal/ui/mounts/kv2/data/foo/bar":
+						return &api.Secret{Data: map[string]interface{}{
+							"path":    "kv2/",
+							"type":    "kv",
+							"options": map[string]interface{}{"version": "2"},
+						}}, nil
+					case "kv2/metadata/foo/bar":
+						return &api.Secret{Data: map[string]interface{}{
+							"current_version": json.Number("3"),
+						}}, nil
+					}
+					return nil, fmt.Errorf("unexpected read of %s", p)
+				}
+			})
+
+			It("should return []models.Version containing the current version", func() {
+				Expect(newResource().Check()).To(Equal([]models.Version{
+					{Path: "kv2/data/foo/bar", Version: "3"},
+				}))
 			})
 		})
 
-		Context("checks the resource for versions and no version is found", func() {
-			It("should return an empty []models.Version", func() {
-				v.CheckReturns(check)
-				Expect(v.Check()).To(Equal(check))
+		Context("with vault_addrs", func() {
+			BeforeEach(func() {
+				request.Source.VaultAddr = ""
+				request.Source.VaultAddrs = []string{
+					"http://127.0.0.1:1",
+					"http://127.0.0.1:2",
+				}
+				logical.ReadReturns(&api.Secret{Data: map[string]interface{}{
+					"path": "kv2/",
+					"type": "kv",
+				}}, nil)
+			})
+
+			It("makes every request through the injected Logical without probing them", func() {
+				Expect(newResource().Check()).To(Equal([]models.Version{
+					{Path: "kv2/data/foo/bar", Version: "1"},
+				}))
+				Expect(logical.ReadCallCount()).To(BeNumerically(">", 0))
+			})
+		})
+
+		Context("checks a dynamic secret", func() {
+			BeforeEach(func() {
+				request.Source.VaultPaths = map[string]int{
+					"database/creds/readonly": 0,
+				}
+				logical.ReadReturns(&api.Secret{Data: map[string]interface{}{
+					"path": "database/",
+					"type": "database",
+				}}, nil)
+			})
+
+			It("should not issue credentials", func() {
+				Expect(newResource().Check()).To(Equal([]models.Version{
+					{Path: "database/creds/readonly", Version: "1"},
+				}))
+				Expect(logical.ReadCallCount()).To(Equal(1))
+				Expect(logical.ReadArgsForCall(0)).To(Equal(
+					"sys/internal/ui/mounts/database/creds/readonly",
+				))
 			})
 		})
 	})
 
 	Describe("when In() is called", func() {
+		BeforeEach(func() {
+			logical.ReadWithDataReturns(&api.Secret{Data: map[string]interface{}{
+				"data": map[string]interface{}{
+					"db": map[string]interface{}{
+						"primary-host": "db.example.com",
+					},
+				},
+				"metadata": map[string]interface{}{
+					"version": json.Number("1"),
+				},
+			}}, nil)
+		})
+
 		Context("retrieves a secret(s) from vault", func() {
-			It("should write the secret(s) to resource/secrets and no error should occur", func() {
-				v.InReturns(err)
-				Expect(v.In()).ShouldNot(HaveOccurred())
+			It("should read the pinned version", func() {
+				_, err := newResource().In()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(logical.ReadWithDataCallCount()).To(Equal(1))
+				p, data := logical.ReadWithDataArgsForCall(0)
+				Expect(p).To(Equal("kv2/data/foo/bar"))
+				Expect(data).To(HaveKeyWithValue("version", []string{"1"}))
+			})
+		})
+
+		Context("transforms the secret(s) before writing them", func() {
+			BeforeEach(func() {
+				request.Source.Flatten = true
+				request.Source.Sanitize = true
+				request.Source.Upcase = true
+				request.Source.Prefix = "app"
+			})
+
+			It("should write the transformed keys", func() {
+				_, err := newResource().In()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				secrets := readSecrets(filepath.Join(workDir, "secrets"))
+				Expect(secrets).To(Equal(map[string]interface{}{
+					"APP_DB_PRIMARY_HOST": "db.example.com",
+				}))
+			})
+		})
+
+		Context("retrieves a dynamic secret from vault", func() {
+			BeforeEach(func() {
+				request.Source.VaultPaths = map[string]int{
+					"database/creds/readonly": 0,
+				}
+				logical.ReadStub = func(p string) (*api.Secret, error) {
+					return &api.Secret{
+						LeaseID:       "database/creds/readonly/abc123",
+						LeaseDuration: 3600,
+						Renewable:     true,
+						Data: map[string]interface{}{
+							"username": "v-readonly",
+							"password": "p4ssw0rd",
+						},
+					}, nil
+				}
+			})
+
+			It("should report and record the lease", func() {
+				metadata, err := newResource().In()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(metadata).To(ContainElement(models.MetadataKvP{
+					Key:   "database/creds/readonly",
+					Value: "lease_id=database/creds/readonly/abc123 ttl=3600s renewable=true",
+				}))
+
+				b, err := ioutil.ReadFile(filepath.Join(workDir, "leases"))
+				Expect(err).NotTo(HaveOccurred())
+
+				var leases []models.Lease
+				Expect(json.Unmarshal(b, &leases)).To(Succeed())
+				Expect(leases).To(Equal([]models.Lease{{
+					Path:          "database/creds/readonly",
+					LeaseID:       "database/creds/readonly/abc123",
+					LeaseDuration: 3600,
+					Renewable:     true,
+				}}))
+			})
+		})
+	})
+
+	Describe("when New() logs in with an approle role", func() {
+		BeforeEach(func() {
+			request.Source.RoleName = "concourse"
+			logical.ReadReturns(&api.Secret{Data: map[string]interface{}{
+				"role_id": "r0l3",
+			}}, nil)
+			logical.WriteStub = func(p string, data map[string]interface{}) (*api.Secret, error) {
+				switch p {
+				case "auth/approle/role/concourse/secret-id":
+					return &api.Secret{Data: map[string]interface{}{
+						"secret_id": "s3cr3t",
+					}}, nil
+				case "auth/approle/login":
+					return &api.Secret{
+						Auth: &api.SecretAuth{ClientToken: "l0g1nT0k3n"},
+					}, nil
+				}
+				return nil, fmt.Errorf("unexpected write to %s", p)
+			}
+		})
+
+		It("should log in with the role_id and a new secret_id", func() {
+			newResource()
+
+			Expect(logical.ReadArgsForCall(0)).To(Equal("auth/approle/role/concourse/role-id"))
+
+			Expect(logical.WriteCallCount()).To(Equal(2))
+			p, _ := logical.WriteArgsForCall(0)
+			Expect(p).To(Equal("auth/approle/role/concourse/secret-id"))
+			p, data := logical.WriteArgsForCall(1)
+			Expect(p).To(Equal("auth/approle/login"))
+			Expect(data).To(Equal(map[string]interface{}{
+				"role_id":   "r0l3",
+				"secret_id": "s3cr3t",
+			}))
+		})
+	})
+
+	Describe("when Out() is called", func() {
+		Context("revokes the leases written by a get step", func() {
+			BeforeEach(func() {
+				request.Params.RevokeLeasesFrom = "vault"
+
+				leases, err := json.Marshal([]models.Lease{{
+					Path:    "database/creds/readonly",
+					LeaseID: "database/creds/readonly/abc123",
+				}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				Expect(os.Mkdir(filepath.Join(workDir, "vault"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(
+					filepath.Join(workDir, "vault", "leases"), leases, 0600,
+				)).To(Succeed())
+			})
+
+			It("should return a response containing the lease results", func() {
+				resp, err := newResource().Out()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(resp.Version.Path).To(Equal("sys/leases/revoke"))
+				Expect(resp.Metadata).To(ContainElement(models.MetadataKvP{
+					Key:   "database/creds/readonly/abc123",
+					Value: "revoked",
+				}))
+
+				p, data := logical.WriteArgsForCall(logical.WriteCallCount() - 1)
+				Expect(p).To(Equal("sys/leases/revoke"))
+				Expect(data).To(HaveKeyWithValue("lease_id", "database/creds/readonly/abc123"))
 			})
 		})
 	})